@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/fatih/color"
+	"github.com/marcosnils/bin/pkg/cache"
+	bstrings "github.com/marcosnils/bin/pkg/strings"
+	"github.com/spf13/cobra"
+)
+
+type cacheCmd struct {
+	cmd *cobra.Command
+}
+
+func newCacheCmd() *cacheCmd {
+	root := &cacheCmd{}
+
+	cmd := &cobra.Command{
+		Use:           "cache",
+		Short:         "Manages the cache of downloaded release assets",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          cobra.NoArgs,
+	}
+
+	cmd.AddCommand(
+		newCacheListCmd().cmd,
+		newCacheClearCmd().cmd,
+		newCachePruneCmd().cmd,
+	)
+
+	root.cmd = cmd
+	return root
+}
+
+type cacheListCmd struct {
+	cmd *cobra.Command
+}
+
+func newCacheListCmd() *cacheListCmd {
+	root := &cacheListCmd{}
+
+	cmd := &cobra.Command{
+		Use:           "list",
+		Aliases:       []string{"ls"},
+		Short:         "Lists the cached downloads, the most recently used first",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := cache.List()
+			if err != nil {
+				return err
+			}
+			dir, err := cache.Dir()
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				log.Infof("The download cache at %s is empty", dir)
+				return nil
+			}
+
+			nL, sL := len("Name"), len("Size")
+			for _, e := range entries {
+				nL = max(nL, len(e.Name))
+				sL = max(sL, len(bstrings.HumanSize(e.Size)))
+			}
+			magentaItalic := color.New(color.FgMagenta, color.Italic).Sprint
+			fmt.Printf("\n%s  %s  %s  %s", magentaItalic(_rPad("Name", nL)), magentaItalic(_rPad("Size", sL)), magentaItalic(_rPad("Last used", 16)), magentaItalic("URL"))
+			for _, e := range entries {
+				fmt.Printf("\n%s  %s  %s  %s", _rPad(e.Name, nL), _rPad(bstrings.HumanSize(e.Size), sL), e.Used.Local().Format("2006-01-02 15:04"), e.URL)
+			}
+			fmt.Printf("\n\n%s in %s (limit %s)\n\n", bstrings.HumanSize(cache.TotalSize(entries)), dir, bstrings.HumanSize(cache.MaxSize()))
+			return nil
+		},
+	}
+
+	root.cmd = cmd
+	return root
+}
+
+type cacheClearCmd struct {
+	cmd *cobra.Command
+}
+
+func newCacheClearCmd() *cacheClearCmd {
+	root := &cacheClearCmd{}
+
+	cmd := &cobra.Command{
+		Use:           "clear",
+		Short:         "Removes every cached download",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := cache.Clear(); err != nil {
+				return err
+			}
+			log.Infof("Download cache cleared")
+			return nil
+		},
+	}
+
+	root.cmd = cmd
+	return root
+}
+
+type cachePruneCmd struct {
+	cmd  *cobra.Command
+	opts cachePruneOpts
+}
+
+type cachePruneOpts struct {
+	maxSize   string
+	unusedFor time.Duration
+}
+
+func newCachePruneCmd() *cachePruneCmd {
+	root := &cachePruneCmd{}
+
+	cmd := &cobra.Command{
+		Use:           "prune",
+		Short:         "Removes the least recently used downloads until the cache fits its size limit",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			maxSize := cache.MaxSize()
+			if root.opts.maxSize != "" {
+				var err error
+				if maxSize, err = cache.ParseSize(root.opts.maxSize); err != nil {
+					return err
+				}
+			}
+
+			removed, err := cache.Prune(maxSize, root.opts.unusedFor)
+			if err != nil {
+				return err
+			}
+			for _, e := range removed {
+				log.Debugf("Removed %s (%s)", e.Name, e.URL)
+			}
+			log.Infof("Removed %d cached downloads", len(removed))
+			return nil
+		},
+	}
+
+	root.cmd = cmd
+	root.cmd.Flags().StringVarP(&root.opts.maxSize, "max-size", "", "", "Size to prune the cache to, like 500MB or 1GiB (defaults to download_cache.max_size)")
+	root.cmd.Flags().DurationVarP(&root.opts.unusedFor, "unused-for", "", 0, "Also remove the downloads that weren't used in this time, like 720h")
+	return root
+}
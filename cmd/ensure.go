@@ -3,8 +3,11 @@ package cmd
 import (
 	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
 
 	"github.com/caarlos0/log"
 	"github.com/fatih/color"
@@ -14,7 +17,13 @@ import (
 )
 
 type ensureCmd struct {
-	cmd *cobra.Command
+	cmd  *cobra.Command
+	opts ensureOpts
+}
+
+type ensureOpts struct {
+	offline bool
+	jobs    int
 }
 
 func newEnsureCmd() *ensureCmd {
@@ -43,68 +52,179 @@ func newEnsureCmd() *ensureCmd {
 				binsToProcess = cfg.Bins
 			}
 
-			// TODO: code smell here, this pretty much does
-			// the same thing as install logic. Refactor to
-			// use the same code in both places
-			for _, binCfg := range binsToProcess {
-				ep := os.ExpandEnv(binCfg.Path)
-				_, err := os.Stat(ep)
+			if err := validateJobs(root.opts.jobs); err != nil {
+				return err
+			}
 
-				if err == nil {
-					f, err := os.Open(ep)
-					if err != nil {
-						return err
+			paths := make([]string, 0, len(binsToProcess))
+			for p := range binsToProcess {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
+
+			// groups are re-installed as a whole once
+			ensuredGroups := map[string]bool{}
+			var tasks []task
+			for _, p := range paths {
+				binCfg := binsToProcess[p]
+				name := os.ExpandEnv(binCfg.Path)
+				if binCfg.Group != "" {
+					if ensuredGroups[binCfg.Group] {
+						continue
 					}
+					ensuredGroups[binCfg.Group] = true
+					name = binCfg.Group
+				}
+				tasks = append(tasks, task{name: name, run: func() error {
+					return root.ensureBinary(binCfg)
+				}})
+			}
+			return firstError(runTasks(tasks, root.opts.jobs, "ensured", true))
+		},
+	}
 
-					h := sha256.New()
-					if _, err := io.Copy(h, f); err != nil {
-						return err
-					}
+	root.cmd = cmd
+	root.cmd.Flags().BoolVarP(&root.opts.offline, "offline", "", false, "Restore the binaries from the download cache without using the network")
+	root.cmd.Flags().IntVarP(&root.opts.jobs, "jobs", "j", defaultJobs, "Number of binaries ensured at once")
+	return root
+}
 
-					if fmt.Sprintf("%x", h.Sum(nil)) == binCfg.Hash {
-						continue
-					}
+// ensureBinary installs binCfg again, or its whole group,
+// unless it's present with the hash of the config
+func (root *ensureCmd) ensureBinary(binCfg *config.Binary) error {
+	// TODO: code smell here, this pretty much does
+	// the same thing as install logic. Refactor to
+	// use the same code in both places
+	ep := os.ExpandEnv(binCfg.Path)
+	_, err := os.Stat(ep)
+
+	if err == nil {
+		f, err := os.Open(ep)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+
+		if fmt.Sprintf("%x", h.Sum(nil)) == binCfg.Hash {
+			return nil
+		}
 
-					log.Infof("%s hash does not match with config's, re-installing", ep)
+		log.Infof("%s hash does not match with config's, re-installing", ep)
 
-				} else if !os.IsNotExist(err) {
-					continue
-				}
+	} else if !os.IsNotExist(err) {
+		return nil
+	}
 
-				p, err := providers.New(binCfg.URL, binCfg.Provider)
-				if err != nil {
-					return err
-				}
-				log.Debugf("Using provider '%s' for '%s'", p.GetID(), binCfg.URL)
+	var p providers.Provider
+	if root.opts.offline {
+		p = providers.NewCached(binCfg.Provider, binCfg.Digest)
+	} else {
+		p, err = providers.New(binCfg.URL, binCfg.Provider)
+		if err != nil {
+			return err
+		}
+	}
+	log.Debugf("Using provider '%s' for '%s'", p.GetID(), binCfg.URL)
+
+	pResult, err := p.Fetch(&providers.FetchOpts{Version: binCfg.Version, All: binCfg.All, PackagePath: binCfg.PackagePath, PackageName: binCfg.RemoteName, NamePattern: binCfg.NamePattern, Files: binCfg.Files, Extras: binCfg.InstallExtras, ScoringRules: binCfg.ScoringRules})
+	if err != nil {
+		if root.opts.offline {
+			return fmt.Errorf("error restoring %s: %w", ep, err)
+		}
+		return err
+	}
+	if root.opts.offline {
+		expectHashes(binCfg, pResult)
+	}
 
-				pResult, err := p.Fetch(&providers.FetchOpts{Version: binCfg.Version})
-				if err != nil {
-					return err
-				}
+	if binCfg.Group != "" {
+		if _, err := saveGroup(p, pResult, filepath.Dir(binCfg.Path), binCfg.Group, binCfg.URL, binCfg, true); err != nil {
+			return err
+		}
+		log.Infof("Done ensuring %s to %s", binCfg.Group, color.GreenString(binCfg.Version))
+		return nil
+	}
 
-				hash, err := saveToDisk(pResult, ep, true)
-				if err != nil {
-					return fmt.Errorf("error installing binary: %w", err)
-				}
+	hash, err := saveToDisk(pResult, ep, true)
+	if err != nil {
+		closeExtras(pResult.Extras)
+		return fmt.Errorf("error installing binary: %w", err)
+	}
 
-				err = config.UpsertBinary(&config.Binary{
-					RemoteName:  pResult.Name,
-					Path:        binCfg.Path,
-					Version:     pResult.Version,
-					Hash:        fmt.Sprintf("%x", hash),
-					URL:         binCfg.URL,
-					Provider:    p.GetID(),
-					PackagePath: binCfg.PackagePath,
-				})
-				if err != nil {
-					return err
-				}
-				log.Infof("Done ensuring %s to %s", os.ExpandEnv(binCfg.Path), color.GreenString(binCfg.Version))
-			}
-			return nil
-		},
+	extras, err := refreshExtras(binCfg, pResult)
+	if err != nil {
+		return err
 	}
 
-	root.cmd = cmd
-	return root
+	err = config.UpsertBinary(&config.Binary{
+		RemoteName:    pResult.Name,
+		Path:          binCfg.Path,
+		Version:       pResult.Version,
+		Hash:          fmt.Sprintf("%x", hash),
+		URL:           binCfg.URL,
+		Provider:      p.GetID(),
+		PackagePath:   binCfg.PackagePath,
+		Pinned:        binCfg.Pinned,
+		Digest:        pResult.Digest,
+		NamePattern:   binCfg.NamePattern,
+		All:           binCfg.All,
+		InstallExtras: binCfg.InstallExtras,
+		Extras:        extras,
+		ScoringRules:  binCfg.ScoringRules,
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("Done ensuring %s to %s", os.ExpandEnv(binCfg.Path), color.GreenString(binCfg.Version))
+	return nil
+}
+
+// expectHashes makes reading the files of f fail unless they have
+// the hashes recorded in the config, so binaries restored from the
+// download cache are the same ones that were installed
+func expectHashes(b *config.Binary, f *providers.File) {
+	if b.Group == "" {
+		f.Data = &hashCheckReader{src: f.Data, h: sha256.New(), want: b.Hash, name: os.ExpandEnv(b.Path)}
+		return
+	}
+	members := map[string]*config.Binary{}
+	for _, m := range config.GroupMembers(b.Group) {
+		members[m.PackagePath] = m
+	}
+	for _, gf := range f.Group {
+		if m, ok := members[gf.PackagePath]; ok {
+			gf.Data = &hashCheckReader{src: gf.Data, h: sha256.New(), want: m.Hash, name: os.ExpandEnv(m.Path)}
+		}
+	}
+}
+
+// hashCheckReader fails at the end of src if
+// its sha256 isn't the wanted one
+type hashCheckReader struct {
+	src  io.Reader
+	h    hash.Hash
+	want string
+	name string
+}
+
+func (r *hashCheckReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.h.Write(p[:n])
+	if err == io.EOF && fmt.Sprintf("%x", r.h.Sum(nil)) != r.want {
+		return n, fmt.Errorf("the cached copy of %s doesn't match its recorded hash", r.name)
+	}
+	return n, err
+}
+
+// Close releases the temp files backing src
+func (r *hashCheckReader) Close() error {
+	if c, ok := r.src.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
 }
@@ -1,5 +1,9 @@
 package cmd
 
+// exitCodeAmbiguous is used when bin can't pick between several
+// options without prompting (options.AmbiguousError)
+const exitCodeAmbiguous = 4
+
 type exitError struct {
 	err     error
 	code    int
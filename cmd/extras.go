@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/marcosnils/bin/pkg/assets"
+	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/providers"
+)
+
+// installExtras installs completions and man pages into
+// the XDG data dir and returns the installed paths
+func installExtras(extras []*assets.ExtraFile) ([]string, error) {
+	if len(extras) == 0 {
+		return nil, nil
+	}
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, e := range extras {
+		p := extraPath(dataDir, e)
+		if err := writeExtra(e, p); err != nil {
+			closeExtras(extras)
+			return nil, fmt.Errorf("error installing %s: %w", e.PackagePath, err)
+		}
+		log.Infof("Installed %s %s into %s", e.Kind, e.Name, p)
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// refreshExtras re-installs the extras of b from a new
+// download and removes the ones that are gone
+func refreshExtras(b *config.Binary, f *providers.File) ([]string, error) {
+	if !b.InstallExtras {
+		return nil, nil
+	}
+	extras, err := installExtras(f.Extras)
+	if err != nil {
+		return nil, err
+	}
+	removeExtras(b.Extras, extras)
+	return extras, nil
+}
+
+// extraPath returns where an extra file is installed
+// following the bash-completion, zsh, fish and man conventions
+func extraPath(dataDir string, e *assets.ExtraFile) string {
+	switch e.Kind {
+	case assets.ExtraBash:
+		name := strings.TrimSuffix(strings.TrimSuffix(e.Name, ".bash-completion"), ".bash")
+		return filepath.Join(dataDir, "bash-completion", "completions", name)
+	case assets.ExtraZsh:
+		name := strings.TrimSuffix(e.Name, ".zsh")
+		if !strings.HasPrefix(name, "_") {
+			name = "_" + name
+		}
+		return filepath.Join(dataDir, "zsh", "site-functions", name)
+	case assets.ExtraFish:
+		return filepath.Join(dataDir, "fish", "vendor_completions.d", e.Name)
+	default:
+		// man pages, the kind is the section directory (e.g. man1)
+		return filepath.Join(dataDir, "man", e.Kind, e.Name)
+	}
+}
+
+func writeExtra(e *assets.ExtraFile, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, e.Source)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if c, ok := e.Source.(io.Closer); ok {
+		c.Close()
+	}
+	return err
+}
+
+// closeExtras releases the extras that weren't installed
+func closeExtras(extras []*assets.ExtraFile) {
+	for _, e := range extras {
+		if c, ok := e.Source.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// removeExtras removes the paths that aren't in keep
+func removeExtras(paths, keep []string) {
+	kept := map[string]bool{}
+	for _, k := range keep {
+		kept[k] = true
+	}
+	for _, p := range paths {
+		if kept[p] {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Error removing %s: %v", p, err)
+		}
+	}
+}
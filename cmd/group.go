@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/caarlos0/log"
+	"github.com/marcosnils/bin/pkg/assets"
+	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/providers"
+)
+
+// saveGroup installs every file of a group fetched by p into dir and
+// records them in the config once all of them are in place, with the
+// selection settings (Files, NamePattern, All, InstallExtras and
+// ScoringRules) of settings. Binaries of the group that aren't part
+// of the new release are left on disk but taken out of the group.
+func saveGroup(p providers.Provider, f *providers.File, dir, group, url string, settings *config.Binary, overwrite bool) ([]*config.Binary, error) {
+	defer closeExtras(f.Extras)
+
+	if len(f.Group) == 0 {
+		if c, ok := f.Data.(io.Closer); ok {
+			c.Close()
+		}
+		return nil, fmt.Errorf("%s is not an archive, --file can only select files from archives", f.Name)
+	}
+
+	paths := make([]string, 0, len(f.Group))
+	for _, m := range f.Group {
+		paths = append(paths, filepath.Join(dir, assets.SanitizeName(m.Name, m.Version)))
+	}
+
+	hashes, err := saveGroupToDisk(f.Group, paths, overwrite)
+	if err != nil {
+		return nil, fmt.Errorf("error installing binaries: %w", err)
+	}
+
+	var extras, oldExtras []string
+	if settings.InstallExtras {
+		if extras, err = installExtras(f.Extras); err != nil {
+			return nil, err
+		}
+	}
+	for _, b := range config.GroupMembers(group) {
+		oldExtras = append(oldExtras, b.Extras...)
+	}
+	removeExtras(oldExtras, extras)
+
+	bins := make([]*config.Binary, 0, len(f.Group))
+	installed := map[string]bool{}
+	for i, m := range f.Group {
+		installed[paths[i]] = true
+		bins = append(bins, &config.Binary{
+			RemoteName:    m.Name,
+			Path:          paths[i],
+			Version:       m.Version,
+			Hash:          fmt.Sprintf("%x", hashes[i]),
+			URL:           url,
+			Provider:      p.GetID(),
+			PackagePath:   m.PackagePath,
+			Digest:        f.Digest,
+			Group:         group,
+			Files:         settings.Files,
+			NamePattern:   settings.NamePattern,
+			All:           settings.All,
+			InstallExtras: settings.InstallExtras,
+			ScoringRules:  settings.ScoringRules,
+		})
+	}
+	// the extras of a group are recorded in its first binary
+	bins[0].Extras = extras
+	// keep the scoring rules and pins of existing binaries
+	for _, b := range bins {
+		if old, ok := config.GetBinary(b.Path); ok {
+			if b.ScoringRules == nil {
+				b.ScoringRules = old.ScoringRules
+			}
+			b.Pinned = old.Pinned
+		}
+	}
+
+	var stale []*config.Binary
+	for _, b := range config.GroupMembers(group) {
+		if !installed[b.Path] {
+			log.Warnf("%s is no longer part of %s, remove it with `bin remove` if it's not needed", os.ExpandEnv(b.Path), group)
+			// the members are shared with the other
+			// goroutines, change a copy
+			c := *b
+			c.Group, c.Files, c.Extras, c.NamePattern = "", nil, nil, ""
+			stale = append(stale, &c)
+		}
+	}
+
+	return bins, config.UpsertBinaries(append(stale, bins...))
+}
+
+// isGroupPinned checks if any binary of group is pinned
+func isGroupPinned(group string) bool {
+	for _, b := range config.GroupMembers(group) {
+		if b.Pinned {
+			return true
+		}
+	}
+	return false
+}
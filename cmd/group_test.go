@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/marcosnils/bin/pkg/cache"
+	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/providers"
+)
+
+// useTestConfig loads an empty config from a temp file
+func useTestConfig(t *testing.T) {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(p, []byte(`{"default_path": "`+filepath.ToSlash(t.TempDir())+`"}`), 0o664); err != nil {
+		t.Fatal(err)
+	}
+	config.SetPath(p)
+	t.Cleanup(func() { config.SetPath("") })
+	if err := config.CheckAndLoad(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// groupRelease returns a release of an archive with the given files
+func groupRelease(version string, names ...string) *providers.File {
+	f := &providers.File{Name: names[0], Version: version}
+	for _, n := range names {
+		f.Group = append(f.Group, &providers.File{Data: strings.NewReader(n + " " + version), Name: n, Version: version, PackagePath: "dist/" + n})
+	}
+	return f
+}
+
+func TestSaveGroupToDisk(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "tool"), filepath.Join(dir, "tool2")}
+	if err := os.WriteFile(paths[0], []byte("old tool"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(paths[1], []byte("old tool2"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := func() []*providers.File {
+		return []*providers.File{
+			{Data: strings.NewReader("new tool"), Name: "tool"},
+			{Data: strings.NewReader("new tool2"), Name: "tool2"},
+		}
+	}
+
+	// without overwrite nothing is replaced
+	if _, err := saveGroupToDisk(files(), paths, false); err == nil {
+		t.Fatal("expected an error for existing binaries")
+	}
+	for i, want := range []string{"old tool", "old tool2"} {
+		if got, _ := os.ReadFile(paths[i]); string(got) != want {
+			t.Errorf("%s: got %q, want %q", paths[i], got, want)
+		}
+	}
+
+	hashes, err := saveGroupToDisk(files(), paths, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 2 {
+		t.Fatalf("expected 2 hashes, got %d", len(hashes))
+	}
+	for i, want := range []string{"new tool", "new tool2"} {
+		if got, _ := os.ReadFile(paths[i]); string(got) != want {
+			t.Errorf("%s: got %q, want %q", paths[i], got, want)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("expected only the installed binaries in %s, got %d files", dir, len(entries))
+	}
+}
+
+func TestInstallGroupTwice(t *testing.T) {
+	useTestConfig(t)
+	p := mockProvider{}
+	u := "github.com/owner/tool"
+	dirs := []string{t.TempDir(), t.TempDir()}
+	for _, dir := range dirs {
+		if err := installGroup(p, groupRelease("1.0.0", "tool", "toolctl"), dir, u, &config.Binary{Files: []string{"tool*"}}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range dirs {
+		b, ok := config.GetBinary(filepath.Join(dir, "tool"))
+		if !ok || b.Group == "" || len(config.GroupMembers(b.Group)) != 2 {
+			t.Errorf("expected the binaries in %s to stay in their own group", dir)
+		}
+	}
+}
+
+func TestSaveGroupsInParallel(t *testing.T) {
+	useTestConfig(t)
+	p := mockProvider{}
+	var dirs []string
+	for i := 0; i < 8; i++ {
+		dirs = append(dirs, t.TempDir())
+	}
+	for _, dir := range dirs {
+		if err := installGroup(p, groupRelease("1.0.0", "tool", "toolctl"), dir, "github.com/owner/tool", &config.Binary{Files: []string{"tool*"}}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// toolctl isn't part of the new release of the groups
+	var tasks []task
+	for _, dir := range dirs {
+		b, _ := config.GetBinary(filepath.Join(dir, "tool"))
+		tasks = append(tasks, task{name: dir, run: func() error {
+			_, err := saveGroup(p, groupRelease("2.0.0", "tool"), dir, b.Group, b.URL, b, true)
+			return err
+		}})
+	}
+	if err := firstError(runTasks(tasks, len(tasks), "updated", false)); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		if b, ok := config.GetBinary(filepath.Join(dir, "toolctl")); !ok || b.Group != "" {
+			t.Errorf("expected toolctl in %s to be taken out of its group", dir)
+		}
+		if b, ok := config.GetBinary(filepath.Join(dir, "tool")); !ok || b.Version != "2.0.0" {
+			t.Errorf("expected tool in %s to be updated", dir)
+		}
+	}
+}
+
+func TestEnsurePinnedGroup(t *testing.T) {
+	useTestConfig(t)
+	t.Setenv("BIN_CACHE_DIR", t.TempDir())
+	dir := t.TempDir()
+	if err := installGroup(mockProvider{}, groupRelease("1.0.0", "tool", "toolctl"), dir, "github.com/owner/tool", &config.Binary{Files: []string{"tool*"}}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// the release asset is in the download cache
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, n := range []string{"tool", "toolctl"} {
+		content := n + " 1.0.0"
+		_ = tw.WriteHeader(&tar.Header{Name: "dist/" + n, Mode: 0o755, Size: int64(len(content))})
+		_, _ = tw.Write([]byte(content))
+	}
+	_ = tw.Close()
+	asset := filepath.Join(t.TempDir(), "tool.tar")
+	if err := os.WriteFile(asset, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	digest := fmt.Sprintf("%x", sha256.Sum256(buf.Bytes()))
+	if err := cache.Store("https://example.com/tool.tar", "tool.tar", asset, digest, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := config.GetBinary(filepath.Join(dir, "tool"))
+	var pinned []*config.Binary
+	for _, m := range config.GroupMembers(b.Group) {
+		c := *m
+		c.Pinned, c.Digest = true, digest
+		pinned = append(pinned, &c)
+	}
+	if err := config.UpsertBinaries(pinned); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(b.Path); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = config.GetBinary(b.Path)
+	ensure := &ensureCmd{opts: ensureOpts{offline: true}}
+	if err := ensure.ensureBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(b.Path); err != nil {
+		t.Errorf("%s wasn't restored: %v", b.Path, err)
+	}
+	if !isGroupPinned(b.Group) || len(config.GroupMembers(b.Group)) != 2 {
+		t.Fatal("expected the group to stay pinned")
+	}
+	for _, m := range config.GroupMembers(b.Group) {
+		if !m.Pinned {
+			t.Errorf("%s was unpinned", m.Path)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"bufio"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/marcosnils/bin/pkg/config"
+)
+
+// binaryChecks enables checkBinary, it's
+// disabled by the root --skip-checks flag
+var binaryChecks = true
+
+// elfArch is the machine, class and byte order of the
+// ELF binaries of a GOARCH
+type elfArch struct {
+	machine elf.Machine
+	class   elf.Class
+	order   binary.ByteOrder
+}
+
+var elfArchs = map[string]elfArch{
+	"386":      {elf.EM_386, elf.ELFCLASS32, binary.LittleEndian},
+	"amd64":    {elf.EM_X86_64, elf.ELFCLASS64, binary.LittleEndian},
+	"arm":      {elf.EM_ARM, elf.ELFCLASS32, binary.LittleEndian},
+	"arm64":    {elf.EM_AARCH64, elf.ELFCLASS64, binary.LittleEndian},
+	"loong64":  {elf.EM_LOONGARCH, elf.ELFCLASS64, binary.LittleEndian},
+	"mips":     {elf.EM_MIPS, elf.ELFCLASS32, binary.BigEndian},
+	"mipsle":   {elf.EM_MIPS, elf.ELFCLASS32, binary.LittleEndian},
+	"mips64":   {elf.EM_MIPS, elf.ELFCLASS64, binary.BigEndian},
+	"mips64le": {elf.EM_MIPS, elf.ELFCLASS64, binary.LittleEndian},
+	"ppc64":    {elf.EM_PPC64, elf.ELFCLASS64, binary.BigEndian},
+	"ppc64le":  {elf.EM_PPC64, elf.ELFCLASS64, binary.LittleEndian},
+	"riscv64":  {elf.EM_RISCV, elf.ELFCLASS64, binary.LittleEndian},
+	"s390x":    {elf.EM_S390, elf.ELFCLASS64, binary.BigEndian},
+}
+
+// elfOS are the operating systems using ELF binaries
+var elfOS = map[string]bool{
+	"android": true, "dragonfly": true, "freebsd": true, "illumos": true,
+	"linux": true, "netbsd": true, "openbsd": true, "solaris": true,
+}
+
+// checkBinary inspects the ELF binary at path, which is going to be
+// installed at finalPath, before it replaces any existing one. It fails
+// if the binary was built for another platform or its interpreter is
+// missing, and warns about the shared libraries that can't be found.
+// Other files are ignored, as well as the interpreter and libraries
+// of binaries for other targets.
+func checkBinary(path, finalPath string) error {
+	if !binaryChecks {
+		return nil
+	}
+	f, err := elf.Open(path)
+	if err != nil {
+		// not an ELF binary
+		return nil
+	}
+	defer f.Close()
+
+	goos, goarch := runtime.GOOS, runtime.GOARCH
+	target := config.GetTarget()
+	if target != nil {
+		goos, goarch = target.OS, target.GetArch()[0]
+	}
+
+	if !elfOS[goos] {
+		return fmt.Errorf("%s is a Linux/Unix ELF binary, it can't run on %s", filepath.Base(finalPath), goos)
+	}
+	if want, ok := elfArchs[goarch]; ok {
+		if f.Machine != want.machine || f.Class != want.class || f.ByteOrder != want.order {
+			return fmt.Errorf("%s is built for %s (%s), it can't run on %s/%s", filepath.Base(finalPath), f.Machine, f.Class, goos, goarch)
+		}
+	}
+
+	// the interpreter and libraries are only
+	// looked up for binaries for the host
+	if target != nil || goos != "linux" || runtime.GOOS != "linux" {
+		return nil
+	}
+
+	interp, err := config.ElfInterpreter(f)
+	if err != nil {
+		return fmt.Errorf("error reading the interpreter of %s: %w", filepath.Base(finalPath), err)
+	}
+	if interp == "" {
+		log.Debugf("%s is statically linked", finalPath)
+		return nil
+	}
+	if _, err := os.Stat(interp); err != nil {
+		return fmt.Errorf("%s needs the %s interpreter, which isn't installed. It might be built for another libc", filepath.Base(finalPath), interp)
+	}
+
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		return fmt.Errorf("error reading the libraries of %s: %w", filepath.Base(finalPath), err)
+	}
+	dirs := libraryDirs(f, finalPath)
+	var missing []string
+	for _, lib := range libs {
+		if !findLibrary(lib, dirs) {
+			missing = append(missing, lib)
+		}
+	}
+	if len(missing) > 0 {
+		log.Warnf("%s needs libraries that couldn't be found, it might not run: %s", filepath.Base(finalPath), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// libraryDirs returns the directories the dynamic loader looks
+// for the libraries of f in, roughly in the same order
+func libraryDirs(f *elf.File, binPath string) []string {
+	var dirs []string
+	origin := filepath.Dir(binPath)
+	for _, tag := range []elf.DynTag{elf.DT_RPATH, elf.DT_RUNPATH} {
+		paths, _ := f.DynString(tag)
+		for _, p := range paths {
+			for _, dir := range filepath.SplitList(p) {
+				dir = strings.ReplaceAll(strings.ReplaceAll(dir, "${ORIGIN}", origin), "$ORIGIN", origin)
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	dirs = append(dirs, filepath.SplitList(os.Getenv("LD_LIBRARY_PATH"))...)
+	dirs = append(dirs, ldSoConfDirs("/etc/ld.so.conf", 0)...)
+	// musl reads its paths from /etc/ld-musl-<arch>.path
+	if paths, _ := filepath.Glob("/etc/ld-musl-*.path"); len(paths) > 0 {
+		for _, p := range paths {
+			if data, err := os.ReadFile(p); err == nil {
+				dirs = append(dirs, strings.FieldsFunc(string(data), func(r rune) bool { return r == ':' || r == '\n' })...)
+			}
+		}
+	}
+	return append(dirs, "/lib", "/usr/lib", "/lib64", "/usr/lib64", "/usr/local/lib")
+}
+
+// ldSoConfDirs returns the directories listed in the ld.so.conf
+// file at path, following its include directives
+func ldSoConfDirs(path string, depth int) []string {
+	if depth > 5 {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var dirs []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(strings.SplitN(s.Text(), "#", 2)[0])
+		if line == "" {
+			continue
+		}
+		if pattern, ok := strings.CutPrefix(line, "include "); ok {
+			pattern = strings.TrimSpace(pattern)
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(path), pattern)
+			}
+			includes, _ := filepath.Glob(pattern)
+			for _, inc := range includes {
+				dirs = append(dirs, ldSoConfDirs(inc, depth+1)...)
+			}
+			continue
+		}
+		dirs = append(dirs, line)
+	}
+	return dirs
+}
+
+func findLibrary(lib string, dirs []string) bool {
+	if strings.Contains(lib, "/") {
+		_, err := os.Stat(lib)
+		return err == nil
+	}
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, lib)); err == nil {
+			return true
+		}
+	}
+	return false
+}
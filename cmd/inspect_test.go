@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/marcosnils/bin/pkg/config"
+)
+
+func TestCheckBinary(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("ELF binaries are only checked on linux")
+	}
+	// the test binary runs on the host
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBinary(exe, "/usr/local/bin/tool"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// but not on other targets
+	t.Cleanup(func() { config.UseTarget(nil) })
+	other := "arm64"
+	if runtime.GOARCH == "arm64" {
+		other = "amd64"
+	}
+	for _, target := range [][2]string{{"linux", other}, {"darwin", runtime.GOARCH}} {
+		tt, err := config.ParseTarget(target[0], target[1], "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.UseTarget(tt)
+		if err := checkBinary(exe, "/usr/local/bin/tool"); err == nil {
+			t.Errorf("%s: expected an error", tt)
+		}
+	}
+	// unless --skip-checks is set
+	binaryChecks = false
+	err = checkBinary(exe, "/usr/local/bin/tool")
+	binaryChecks = true
+	if err != nil {
+		t.Errorf("unexpected error with the checks disabled: %v", err)
+	}
+	config.UseTarget(nil)
+
+	// other files aren't checked
+	script := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBinary(script, script); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLdSoConfDirs(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "ld.so.conf.d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ld.so.conf"), []byte("# comment\ninclude ld.so.conf.d/*.conf\n/opt/lib\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ld.so.conf.d", "x86_64-linux-gnu.conf"), []byte("/lib/x86_64-linux-gnu\n/usr/lib/x86_64-linux-gnu # multiarch\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/lib/x86_64-linux-gnu", "/usr/lib/x86_64-linux-gnu", "/opt/lib"}
+	if got := ldSoConfDirs(filepath.Join(dir, "ld.so.conf"), 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -25,6 +26,14 @@ type installOpts struct {
 	provider string
 	all      bool
 	name     string
+	version  string
+	files    []string
+	extras   bool
+
+	goos      string
+	arch      string
+	libc      string
+	outputDir string
 }
 
 func newInstallCmd() *installCmd {
@@ -38,9 +47,16 @@ func newInstallCmd() *installCmd {
 		SilenceErrors: true,
 		Args:          cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			u := args[0]
+			u := providers.LocalPath(args[0])
 			defaultPath := config.Get().DefaultPath
 
+			if root.opts.outputDir != "" && root.opts.extras {
+				return fmt.Errorf("--extras can't be used with --output-dir")
+			}
+			if err := selectTarget(root.opts.goos, root.opts.arch, root.opts.libc, root.opts.outputDir != ""); err != nil {
+				return err
+			}
+
 			var resolvedPath string
 			if len(args) > 1 {
 				resolvedPath = args[1]
@@ -61,10 +77,29 @@ func newInstallCmd() *installCmd {
 			}
 			log.Debugf("Using provider '%s' for '%s'", p.GetID(), u)
 
-			pResult, err := p.Fetch(&providers.FetchOpts{All: root.opts.all, NamePattern: root.opts.name})
+			pResult, err := p.Fetch(&providers.FetchOpts{All: root.opts.all, NamePattern: root.opts.name, Version: root.opts.version, Files: root.opts.files, Extras: root.opts.extras})
 			if err != nil {
 				return err
 			}
+			defer closeExtras(pResult.Extras)
+
+			if root.opts.outputDir != "" {
+				var name string
+				if len(args) > 1 {
+					name = args[1]
+				}
+				return installToDir(pResult, root.opts.outputDir, name, len(root.opts.files) > 0, root.opts.force)
+			}
+
+			if len(root.opts.files) > 0 {
+				settings := &config.Binary{
+					Files:         root.opts.files,
+					NamePattern:   selectedPattern(root.opts.name, pResult),
+					All:           root.opts.all,
+					InstallExtras: root.opts.extras,
+				}
+				return installGroup(p, pResult, resolvedPath, u, settings, root.opts.force)
+			}
 
 			resolvedPath, err = checkFinalPath(resolvedPath, assets.SanitizeName(pResult.Name, pResult.Version))
 			if err != nil {
@@ -76,6 +111,13 @@ func newInstallCmd() *installCmd {
 				return fmt.Errorf("error installing binary: %w", err)
 			}
 
+			var extras []string
+			if root.opts.extras {
+				if extras, err = installExtras(pResult.Extras); err != nil {
+					return err
+				}
+			}
+
 			// Convert to absolute path before storing in config
 			absPath, err := filepath.Abs(resolvedPath)
 			if err != nil {
@@ -83,13 +125,18 @@ func newInstallCmd() *installCmd {
 			}
 
 			err = config.UpsertBinary(&config.Binary{
-				RemoteName:  pResult.Name,
-				Path:        absPath,
-				Version:     pResult.Version,
-				Hash:        fmt.Sprintf("%x", hash),
-				URL:         u,
-				Provider:    p.GetID(),
-				PackagePath: pResult.PackagePath,
+				RemoteName:    pResult.Name,
+				Path:          absPath,
+				Version:       pResult.Version,
+				Hash:          fmt.Sprintf("%x", hash),
+				URL:           u,
+				Provider:      p.GetID(),
+				PackagePath:   pResult.PackagePath,
+				Digest:        pResult.Digest,
+				NamePattern:   selectedPattern(root.opts.name, pResult),
+				All:           root.opts.all,
+				InstallExtras: root.opts.extras,
+				Extras:        extras,
 			})
 			if err != nil {
 				return err
@@ -106,9 +153,120 @@ func newInstallCmd() *installCmd {
 	root.cmd.Flags().BoolVarP(&root.opts.all, "all", "a", false, "Show all possible download options (skip scoring & filtering)")
 	root.cmd.Flags().StringVarP(&root.opts.provider, "provider", "p", "", "Forces to use a specific provider")
 	root.cmd.Flags().StringVarP(&root.opts.name, "name", "n", "", "Glob pattern to select a specific asset (use asset/file for archive contents)")
+	root.cmd.Flags().StringVarP(&root.opts.version, "version", "", "", "Version to install. Required for local files without a version in their name")
+	root.cmd.Flags().BoolVarP(&root.opts.extras, "extras", "", false, "Also install the shell completions and man pages found in the archive")
+	root.cmd.Flags().StringArrayVarP(&root.opts.files, "file", "", nil, "Name or glob of an archive file to install, can be repeated to install several files as a group")
+	root.cmd.Flags().StringVarP(&root.opts.goos, "os", "", "", "Select binaries for another OS (e.g. linux, darwin, windows)")
+	root.cmd.Flags().StringVarP(&root.opts.arch, "arch", "", "", "Select binaries for another architecture (e.g. arm64, armv7, x86_64_v3)")
+	root.cmd.Flags().StringVarP(&root.opts.libc, "libc", "", "", "Select binaries for another libc (glibc or musl)")
+	root.cmd.Flags().StringVarP(&root.opts.outputDir, "output-dir", "o", "", "Save the binaries into this directory without managing them in the config")
 	return root
 }
 
+// installGroup installs the files of a group into dir,
+// which must be an existing directory
+func installGroup(p providers.Provider, f *providers.File, dir, u string, settings *config.Binary, overwrite bool) error {
+	fi, err := os.Stat(os.ExpandEnv(dir))
+	if err != nil || !fi.IsDir() {
+		return fmt.Errorf("%s must be an existing directory when using --file", dir)
+	}
+	absDir, err := filepath.Abs(os.ExpandEnv(dir))
+	if err != nil {
+		return fmt.Errorf("error converting to absolute path: %w", err)
+	}
+
+	bins, err := saveGroup(p, f, absDir, groupName(u, absDir), u, settings, overwrite)
+	if err != nil {
+		return err
+	}
+	for _, b := range bins {
+		log.Infof("Done installing %s %s", b.Path, b.Version)
+	}
+	return nil
+}
+
+// groupName returns the name of the group installed from u into dir,
+// the same URL can be installed as a group in several directories
+func groupName(u, dir string) string {
+	return fmt.Sprintf("%s in %s", u, dir)
+}
+
+// selectedPattern returns the name pattern to record for a binary
+// installed with --name. The asset and the archive file picked from
+// prompts are added to it, with their version replaced by a wildcard,
+// so updates select the same ones again without prompting.
+func selectedPattern(namePattern string, f *providers.File) string {
+	asset, file, hasFile := strings.Cut(namePattern, "/")
+	if asset == "" && f.PickedAsset && f.Asset != "" {
+		asset = versionGlob(f.Asset, f.Version)
+	}
+	if !hasFile && f.PickedFile && f.PackagePath != "" {
+		file, hasFile = versionGlob(path.Base(f.PackagePath), f.Version), true
+	}
+	if !hasFile {
+		return asset
+	}
+	if asset == "" {
+		asset = "*"
+	}
+	return asset + "/" + file
+}
+
+// globEscaper escapes the glob metacharacters of a name
+// with character classes, backslashes aren't escapes on Windows
+var globEscaper = strings.NewReplacer("[", "[[]", "*", "[*]", "?", "[?]")
+
+// versionGlob returns a glob matching name in other versions, the
+// version is only replaced where it isn't part of another word, like
+// the 6 of armv6
+func versionGlob(name, version string) string {
+	v := strings.TrimPrefix(version, "v")
+	if v == "" {
+		return globEscaper.Replace(name)
+	}
+	var b strings.Builder
+	rest := name
+	for {
+		i := strings.Index(rest, v)
+		if i < 0 {
+			break
+		}
+		before, after := rest[:i], rest[i+len(v):]
+		b.WriteString(globEscaper.Replace(before))
+		if versionStart(name[:len(name)-len(rest)+i]) && versionEnd(after) {
+			b.WriteString("*")
+		} else {
+			b.WriteString(globEscaper.Replace(v))
+		}
+		rest = after
+	}
+	b.WriteString(globEscaper.Replace(rest))
+	return b.String()
+}
+
+// versionStart checks if a version can start after prefix,
+// at its beginning, after a separator or a v that follows one
+func versionStart(prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "v")
+	return prefix == "" || !isAlnum(prefix[len(prefix)-1])
+}
+
+// versionEnd checks if a version can end before suffix,
+// at its end or before a separator that isn't a decimal point
+func versionEnd(suffix string) bool {
+	if suffix == "" {
+		return true
+	}
+	if suffix[0] == '.' {
+		return len(suffix) == 1 || suffix[1] < '0' || suffix[1] > '9'
+	}
+	return !isAlnum(suffix[0])
+}
+
+func isAlnum(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
 // checkFinalPath checks if path exists and if it's a dir or not
 // and returns the correct final file path. It also
 // checks if the path already exists and prompts
@@ -135,6 +293,78 @@ func checkFinalPath(path, fileName string) (string, error) {
 // TODO: check if other binary has the same hash and warn about it.
 // TODO: if the file is zipped, tared, whatever then extract it
 func saveToDisk(f *providers.File, path string, overwrite bool) ([]byte, error) {
+	s, err := stageToDisk(f, path)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.commit(overwrite); err != nil {
+		return nil, err
+	}
+	s.cleanup()
+	return s.hash, nil
+}
+
+// saveGroupToDisk saves every file to its path. All the files
+// are written before replacing any existing binary, and the
+// replaced binaries are restored if any of them fails.
+func saveGroupToDisk(files []*providers.File, paths []string, overwrite bool) ([][]byte, error) {
+	staged := make([]*stagedFile, 0, len(files))
+	for i, f := range files {
+		s, err := stageToDisk(f, paths[i])
+		if err != nil {
+			for _, s := range staged {
+				s.discard()
+			}
+			// release the data of the remaining files
+			for _, f := range files[i+1:] {
+				if c, ok := f.Data.(io.Closer); ok {
+					c.Close()
+				}
+			}
+			return nil, err
+		}
+		staged = append(staged, s)
+	}
+
+	for i, s := range staged {
+		if err := s.commit(overwrite); err != nil {
+			for _, c := range staged[:i] {
+				c.rollback()
+			}
+			for _, d := range staged[i+1:] {
+				d.discard()
+			}
+			return nil, err
+		}
+	}
+
+	hashes := make([][]byte, 0, len(staged))
+	for _, s := range staged {
+		s.cleanup()
+		hashes = append(hashes, s.hash)
+	}
+	return hashes, nil
+}
+
+// stagedFile is a binary written next to its final
+// path that hasn't replaced the existing one yet
+type stagedFile struct {
+	path    string
+	newPath string
+	oldPath string
+	hash    []byte
+	// replaced is set when an existing binary was moved aside
+	replaced bool
+}
+
+// stageToDisk writes f to a temp .new file next to path
+// and checks it can run on the target platform
+func stageToDisk(f *providers.File, path string) (*stagedFile, error) {
+	// release any temp file backing the data, even on errors
+	if c, ok := f.Data.(io.Closer); ok {
+		defer c.Close()
+	}
+
 	epath := os.ExpandEnv(path)
 
 	dir := filepath.Dir(epath)
@@ -142,9 +372,13 @@ func saveToDisk(f *providers.File, path string, overwrite bool) ([]byte, error)
 
 	// Write to a temp .new file first to allow atomic replacement.
 	// This is required on Windows where in-place writes to running binaries fail.
-	newPath := filepath.Join(dir, fmt.Sprintf(".%s.new", base))
+	s := &stagedFile{
+		path:    epath,
+		newPath: filepath.Join(dir, fmt.Sprintf(".%s.new", base)),
+		oldPath: filepath.Join(dir, fmt.Sprintf(".%s.old", base)),
+	}
 
-	file, err := os.OpenFile(newPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o766)
+	file, err := os.OpenFile(s.newPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o766)
 	if err != nil {
 		return nil, err
 	}
@@ -156,38 +390,66 @@ func saveToDisk(f *providers.File, path string, overwrite bool) ([]byte, error)
 	_, err = io.Copy(file, tr)
 	file.Close()
 	if err != nil {
-		_ = os.Remove(newPath)
+		_ = os.Remove(s.newPath)
+		return nil, err
+	}
+	// check the binary before it replaces a working one
+	if err := checkBinary(s.newPath, epath); err != nil {
+		_ = os.Remove(s.newPath)
 		return nil, err
 	}
+	s.hash = h.Sum(nil)
+	return s, nil
+}
 
+// commit moves the staged file into place, moving
+// the existing binary aside if overwrite is set
+func (s *stagedFile) commit(overwrite bool) error {
 	// If the target already exists, check overwrite flag and move it aside.
-	oldPath := filepath.Join(dir, fmt.Sprintf(".%s.old", base))
-	_ = os.Remove(oldPath)
+	_ = os.Remove(s.oldPath)
 
-	_, statErr := os.Stat(epath)
+	_, statErr := os.Stat(s.path)
 	if statErr == nil {
 		if !overwrite {
-			_ = os.Remove(newPath)
-			return nil, fmt.Errorf("%w", os.ErrExist)
+			_ = os.Remove(s.newPath)
+			return fmt.Errorf("%w", os.ErrExist)
 		}
-		log.Debugf("Overwrite flag set, moving %s to %s\n", epath, oldPath)
-		if err = os.Rename(epath, oldPath); err != nil {
-			_ = os.Remove(newPath)
-			return nil, err
+		log.Debugf("Overwrite flag set, moving %s to %s\n", s.path, s.oldPath)
+		if err := os.Rename(s.path, s.oldPath); err != nil {
+			_ = os.Remove(s.newPath)
+			return err
 		}
+		s.replaced = true
 	}
 
 	// Atomically move the new file into place.
-	if err = os.Rename(newPath, epath); err != nil {
+	if err := os.Rename(s.newPath, s.path); err != nil {
 		// Attempt rollback if we moved the old file aside.
-		if rerr := os.Rename(oldPath, epath); rerr != nil {
-			log.Debugf("Rollback failed, %s may be missing: %v\n", epath, rerr)
+		if rerr := os.Rename(s.oldPath, s.path); rerr != nil {
+			log.Debugf("Rollback failed, %s may be missing: %v\n", s.path, rerr)
 		}
-		return nil, err
+		return err
+	}
+	return nil
+}
+
+// rollback restores the binary replaced by a commit
+func (s *stagedFile) rollback() {
+	if !s.replaced {
+		_ = os.Remove(s.path)
+		return
+	}
+	if err := os.Rename(s.oldPath, s.path); err != nil {
+		log.Debugf("Rollback failed, %s may be missing: %v\n", s.path, err)
 	}
+}
 
-	// Clean up the old file.
-	_ = os.Remove(oldPath)
+// discard removes a file that was staged but not committed
+func (s *stagedFile) discard() {
+	_ = os.Remove(s.newPath)
+}
 
-	return h.Sum(nil), nil
+// cleanup removes the replaced binary once it's no longer needed
+func (s *stagedFile) cleanup() {
+	_ = os.Remove(s.oldPath)
 }
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/marcosnils/bin/pkg/providers"
+)
+
+func TestVersionGlob(t *testing.T) {
+	cases := []struct {
+		name, version, want string
+	}{
+		{"tool_1.2.3_linux_amd64.tar.gz", "v1.2.3", "tool_*_linux_amd64.tar.gz"},
+		{"tool-v1.2.3-x86_64-unknown-linux-musl.tar.gz", "v1.2.3", "tool-v*-x86_64-unknown-linux-musl.tar.gz"},
+		{"tool-linux-amd64", "v1.2.3", "tool-linux-amd64"},
+		{"tool-linux-amd64", "", "tool-linux-amd64"},
+		{"tool-v6-armv6", "v6", "tool-v*-armv6"},
+		{"tool-1.2.30-linux", "1.2.3", "tool-1.2.30-linux"},
+		{"tool[1.2]-linux?", "1.2", "tool[[]*]-linux[?]"},
+	}
+	for _, c := range cases {
+		got := versionGlob(c.name, c.version)
+		if got != c.want {
+			t.Errorf("versionGlob(%q, %q) = %q, want %q", c.name, c.version, got, c.want)
+		}
+		if ok, err := filepath.Match(got, c.name); !ok || err != nil {
+			t.Errorf("%q doesn't match %q (%v)", got, c.name, err)
+		}
+	}
+}
+
+func TestSelectedPattern(t *testing.T) {
+	cases := []struct {
+		name string
+		file providers.File
+		want string
+	}{
+		{"", providers.File{Asset: "tool_1.0.0_linux.tar.gz", Version: "1.0.0"}, ""},
+		{"", providers.File{Asset: "tool_1.0.0_linux.tar.gz", Version: "1.0.0", PickedAsset: true}, "tool_*_linux.tar.gz"},
+		{"", providers.File{PackagePath: "tool-1.0.0/bin/tool", Version: "1.0.0", PickedFile: true}, "*/tool"},
+		{"tool_*", providers.File{Asset: "tool_1.0.0_linux.tar.gz", PackagePath: "tool-1.0.0/tool-1.0.0", Version: "1.0.0", PickedFile: true}, "tool_*/tool-*"},
+		{"tool_*/tool", providers.File{Asset: "tool_1.0.0_linux.tar.gz", PackagePath: "bin/tool", Version: "1.0.0"}, "tool_*/tool"},
+	}
+	for i, c := range cases {
+		if got := selectedPattern(c.name, &c.file); got != c.want {
+			t.Errorf("case %d: got %q, want %q", i, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/caarlos0/log"
+	"github.com/marcosnils/bin/pkg/assets"
+	"github.com/marcosnils/bin/pkg/options"
+)
+
+// defaultJobs is how many binaries update and
+// ensure process at once, changed with --jobs
+const defaultJobs = 10
+
+// task is the work done for a binary, or a group of binaries
+type task struct {
+	name string
+	run  func() error
+}
+
+// runTasks runs tasks with at most jobs of them at once and logs
+// the progress as they finish, described by done. If failFast is
+// set, no more tasks are started after one fails. It returns the
+// error of each task, nil for the ones that succeeded or didn't
+// start.
+func runTasks(tasks []task, jobs int, done string, failFast bool) []error {
+	errs := make([]error, len(tasks))
+	if len(tasks) == 0 {
+		return errs
+	}
+	jobs = max(min(jobs, len(tasks)), 1)
+	if jobs > 1 {
+		// the progress bars of concurrent downloads would overwrite
+		// each other, the task progress is logged instead
+		assets.SetProgress(false)
+		defer assets.SetProgress(true)
+		// and the output of the other tasks is held
+		// while one of them prompts
+		if l, ok := log.Log.(*log.Logger); ok {
+			w := l.Writer.Forward
+			l.Writer.Forward = options.HoldWhilePrompting(w)
+			defer func() { l.Writer.Forward = w }()
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		finished int
+		failed   bool
+		wg       sync.WaitGroup
+	)
+	queue := make(chan int)
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				mu.Lock()
+				skip := failFast && failed
+				mu.Unlock()
+				if skip {
+					continue
+				}
+				err := tasks[i].run()
+
+				mu.Lock()
+				finished++
+				errs[i] = err
+				if err != nil {
+					failed = true
+					log.Debugf("[%d/%d] %s failed: %v", finished, len(tasks), tasks[i].name, err)
+				} else if len(tasks) > 1 {
+					log.Infof("[%d/%d] %s %s", finished, len(tasks), done, tasks[i].name)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range tasks {
+		mu.Lock()
+		stop := failFast && failed
+		mu.Unlock()
+		if stop {
+			break
+		}
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return errs
+}
+
+// firstError returns the first error of errs
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateJobs checks the value of --jobs
+func validateJobs(jobs int) error {
+	if jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunTasks(t *testing.T) {
+	var mu sync.Mutex
+	running, most := 0, 0
+	var tasks []task
+	for i := 0; i < 8; i++ {
+		tasks = append(tasks, task{name: fmt.Sprint(i), run: func() error {
+			mu.Lock()
+			running++
+			most = max(most, running)
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			if i == 5 {
+				return fmt.Errorf("task %d failed", i)
+			}
+			return nil
+		}})
+	}
+
+	errs := runTasks(tasks, 3, "ran", false)
+	if most != 3 {
+		t.Errorf("expected 3 tasks at once, got %d", most)
+	}
+	for i, err := range errs {
+		if (err != nil) != (i == 5) {
+			t.Errorf("unexpected error for task %d: %v", i, err)
+		}
+	}
+	if err := firstError(errs); err == nil || err.Error() != "task 5 failed" {
+		t.Errorf("unexpected first error %v", err)
+	}
+
+	started := 0
+	failing := []task{{name: "fails", run: func() error { started++; return errors.New("failed") }}}
+	for i := 0; i < 3; i++ {
+		failing = append(failing, task{name: fmt.Sprint(i), run: func() error { started++; return nil }})
+	}
+	if err := firstError(runTasks(failing, 1, "ran", true)); err == nil {
+		t.Error("expected an error")
+	}
+	if started != 1 {
+		t.Errorf("expected no tasks to start after the failure, %d ran", started)
+	}
+}
@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/caarlos0/log"
 	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/options"
 	"github.com/marcosnils/bin/pkg/prompt"
 	"github.com/spf13/cobra"
 )
@@ -44,6 +47,9 @@ func newPruneCmd() *pruneCmd {
 
 			if !root.opts.force {
 				err := prompt.Confirm("The following paths will be removed. Continue?")
+				if errors.Is(err, options.ErrNonInteractive) {
+					return fmt.Errorf("%w, use --force to remove them without confirmation", err)
+				}
 				if err != nil {
 					return err
 				}
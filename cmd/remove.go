@@ -42,14 +42,24 @@ func newRemoveCmd() *removeCmd {
 					return err
 				}
 				ebp := os.ExpandEnv(bp)
-				if _, ok := bins[ebp]; ok {
-					existingToRemove = append(existingToRemove, ebp)
+				if b, ok := bins[ebp]; ok {
+					members := []*config.Binary{b}
+					// binaries installed as a group are removed together
+					if b.Group != "" {
+						members = config.GroupMembers(b.Group)
+					}
+
+					for _, m := range members {
+						rp := m.Path
+						removeExtras(m.Extras, nil)
+						existingToRemove = append(existingToRemove, rp)
 
-					// TODO some providers (like docker) might download
-					// additional things somewhere else, maybe we should
-					// call the provider to do a cleanup here.
-					if err := os.Remove(os.ExpandEnv(bp)); err != nil && !os.IsNotExist(err) {
-						return fmt.Errorf("error removing path %s: %v", os.ExpandEnv(bp), err)
+						// TODO some providers (like docker) might download
+						// additional things somewhere else, maybe we should
+						// call the provider to do a cleanup here.
+						if err := os.Remove(os.ExpandEnv(rp)); err != nil && !os.IsNotExist(err) {
+							return fmt.Errorf("error removing path %s: %v", os.ExpandEnv(rp), err)
+						}
 					}
 					continue
 				}
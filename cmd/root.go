@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -10,6 +11,7 @@ import (
 	"github.com/caarlos0/log"
 	"github.com/fatih/color"
 	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/options"
 	"github.com/spf13/cobra"
 )
 
@@ -44,6 +46,8 @@ func (cmd *rootCmd) Execute(args []string) {
 			if eerr.details != "" {
 				msg = eerr.details
 			}
+		} else if ae := (*options.AmbiguousError)(nil); errors.As(err, &ae) {
+			code = exitCodeAmbiguous
 		}
 		log.WithError(err).Error(msg)
 		cmd.exit(code)
@@ -51,9 +55,12 @@ func (cmd *rootCmd) Execute(args []string) {
 }
 
 type rootCmd struct {
-	cmd   *cobra.Command
-	debug bool
-	exit  func(int)
+	cmd            *cobra.Command
+	debug          bool
+	nonInteractive bool
+	skipChecks     bool
+	configPath     string
+	exit           func(int)
 }
 
 func newRootCmd(version string, exit func(int)) *rootCmd {
@@ -66,21 +73,36 @@ func newRootCmd(version string, exit func(int)) *rootCmd {
 		Version:       version,
 		SilenceUsage:  true,
 		SilenceErrors: true,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			if root.debug {
 				log.SetLevel(log.DebugLevel)
 				log.Debugf("debug logs enabled, version: %s\n", version)
 			}
 
+			// prompts can't be answered without a terminal
+			if root.nonInteractive || !options.IsTerminal(os.Stdin) {
+				log.Debugf("non-interactive mode enabled")
+				options.SetInteractive(false)
+			}
+
+			binaryChecks = !root.skipChecks
+
+			if root.configPath != "" {
+				config.SetPath(root.configPath)
+			}
+
 			// check and load config after handlers are configured
-			err := config.CheckAndLoad()
-			if err != nil {
-				log.Fatalf("Error loading config file %v", err)
+			if err := config.CheckAndLoad(); err != nil {
+				return fmt.Errorf("error loading config file: %w", err)
 			}
+			return nil
 		},
 	}
 
 	cmd.PersistentFlags().BoolVar(&root.debug, "debug", false, "Enable debug mode")
+	cmd.PersistentFlags().BoolVar(&root.nonInteractive, "non-interactive", false, "Fail instead of prompting, enabled when stdin isn't a terminal")
+	cmd.PersistentFlags().BoolVar(&root.skipChecks, "skip-checks", false, "Install binaries even if they don't seem to run on this platform")
+	cmd.PersistentFlags().StringVar(&root.configPath, "config", "", "Use this config file instead of the default one (created if it doesn't exist)")
 	cmd.AddCommand(
 		newInstallCmd().cmd,
 		newEnsureCmd().cmd,
@@ -90,6 +112,8 @@ func newRootCmd(version string, exit func(int)) *rootCmd {
 		newRemoveCmd().cmd,
 		newListCmd().cmd,
 		newPruneCmd().cmd,
+		newSelectionCmd().cmd,
+		newCacheCmd().cmd,
 	)
 
 	root.cmd = cmd
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/marcosnils/bin/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+type selectionCmd struct {
+	cmd  *cobra.Command
+	opts selectionOpts
+}
+
+type selectionOpts struct {
+	name        string
+	packagePath string
+	all         bool
+	files       []string
+	reset       bool
+}
+
+func newSelectionCmd() *selectionCmd {
+	root := &selectionCmd{}
+
+	cmd := &cobra.Command{
+		Use:           "selection <name | path>",
+		Short:         "Shows or edits how the assets and files of a binary are selected on updates",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := getBinPath(args[0])
+			if err != nil {
+				return err
+			}
+			b := config.Get().Bins[path]
+
+			bins := []*config.Binary{b}
+			if b.Group != "" {
+				bins = config.GroupMembers(b.Group)
+			}
+
+			flags := cmd.Flags()
+			if flags.Changed("file") && b.Group == "" {
+				return fmt.Errorf("--file can only change the files of a group, install them again with --file instead")
+			}
+			if flags.Changed("package-path") && b.Group != "" {
+				return fmt.Errorf("--package-path can't be set for groups, use --file instead")
+			}
+
+			changed := false
+			for _, m := range bins {
+				if root.opts.reset {
+					m.NamePattern, m.All, m.PackagePath = "", false, ""
+					changed = true
+				}
+				if flags.Changed("name") {
+					m.NamePattern, changed = root.opts.name, true
+				}
+				if flags.Changed("all") {
+					m.All, changed = root.opts.all, true
+				}
+				if flags.Changed("package-path") {
+					m.PackagePath, changed = root.opts.packagePath, true
+				}
+				if flags.Changed("file") {
+					m.Files, changed = root.opts.files, true
+				}
+			}
+			if changed {
+				if err := config.UpsertBinaries(bins); err != nil {
+					return err
+				}
+				log.Infof("Updated the selection of %s", os.ExpandEnv(b.Path))
+			}
+
+			printSelection(b)
+			return nil
+		},
+	}
+
+	root.cmd = cmd
+	root.cmd.Flags().StringVarP(&root.opts.name, "name", "n", "", "Glob pattern to select the asset (use asset/file for archive contents), empty to use the scoring")
+	root.cmd.Flags().StringVarP(&root.opts.packagePath, "package-path", "", "", "Path of the binary inside the archive")
+	root.cmd.Flags().BoolVarP(&root.opts.all, "all", "a", false, "Pick from all the assets of the release (skip scoring & filtering)")
+	root.cmd.Flags().StringArrayVarP(&root.opts.files, "file", "", nil, "Name or glob of the archive files of a group, can be repeated")
+	root.cmd.Flags().BoolVarP(&root.opts.reset, "reset", "", false, "Clear the recorded name pattern, --all and package path")
+	return root
+}
+
+func printSelection(b *config.Binary) {
+	value := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	fmt.Printf("%-14s %s\n", "name pattern:", value(b.NamePattern))
+	fmt.Printf("%-14s %t\n", "all:", b.All)
+	if b.Group != "" {
+		fmt.Printf("%-14s %s\n", "files:", value(strings.Join(b.Files, ", ")))
+	} else {
+		fmt.Printf("%-14s %s\n", "package path:", value(b.PackagePath))
+	}
+}
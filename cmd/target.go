@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/caarlos0/log"
+	"github.com/marcosnils/bin/pkg/assets"
+	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/providers"
+)
+
+// selectTarget applies the --os, --arch and --libc flags. Binaries
+// for another platform are only recorded in a config made for that
+// platform, either a new one chosen with --config or one that already
+// has the same target, so they aren't mixed with the host binaries.
+// With --output-dir nothing is recorded and the target is only used
+// for this run.
+func selectTarget(goos, arch, libc string, outputDir bool) error {
+	if goos == "" && arch == "" && libc == "" {
+		return nil
+	}
+	t, err := config.ParseTarget(goos, arch, libc)
+	if err != nil {
+		return err
+	}
+	if outputDir {
+		log.Debugf("Selecting binaries for %s", t)
+		config.UseTarget(t)
+		return nil
+	}
+
+	current := config.Get().Target
+	switch {
+	case current != nil && current.Equal(t):
+		return nil
+	case current != nil:
+		return fmt.Errorf("the config selects binaries for %s, use --output-dir or another --config to install binaries for %s", current, t)
+	case !config.IsCustomPath():
+		return fmt.Errorf("use --output-dir or a separate --config to install binaries for %s", t)
+	case len(config.Get().Bins) > 0:
+		return fmt.Errorf("the config already has binaries for the host, use --output-dir or a new --config to install binaries for %s", t)
+	}
+	log.Infof("Binaries of this config will be selected for %s", t)
+	return config.SetTarget(t)
+}
+
+// installToDir saves f into dir without recording it in the config.
+// name is the file name to use, only for single binaries.
+func installToDir(f *providers.File, dir, name string, grouped, overwrite bool) error {
+	dir = os.ExpandEnv(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating output directory: %w", err)
+	}
+
+	if !grouped {
+		if name == "" {
+			name = assets.SanitizeName(f.Name, f.Version)
+		}
+		path := filepath.Join(dir, name)
+		if _, err := saveToDisk(f, path, overwrite); err != nil {
+			return fmt.Errorf("error installing binary: %w", err)
+		}
+		log.Infof("Done installing %s %s into %s", f.Name, f.Version, path)
+		return nil
+	}
+
+	if len(f.Group) == 0 {
+		if c, ok := f.Data.(io.Closer); ok {
+			c.Close()
+		}
+		return fmt.Errorf("%s is not an archive, --file can only select files from archives", f.Name)
+	}
+	paths := make([]string, 0, len(f.Group))
+	for _, m := range f.Group {
+		paths = append(paths, filepath.Join(dir, assets.SanitizeName(m.Name, m.Version)))
+	}
+	if _, err := saveGroupToDisk(f.Group, paths, overwrite); err != nil {
+		return fmt.Errorf("error installing binaries: %w", err)
+	}
+	for i, m := range f.Group {
+		log.Infof("Done installing %s %s into %s", m.Name, m.Version, paths[i])
+	}
+	return nil
+}
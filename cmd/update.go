@@ -1,13 +1,20 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/caarlos0/log"
 	"github.com/fatih/color"
 	"github.com/hashicorp/go-version"
 	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/options"
 	"github.com/marcosnils/bin/pkg/prompt"
 	"github.com/marcosnils/bin/pkg/providers"
 	"github.com/spf13/cobra"
@@ -24,6 +31,7 @@ type updateOpts struct {
 	all             bool
 	skipPathCheck   bool
 	continueOnError bool
+	jobs            int
 }
 
 type updateInfo struct{ version, url string }
@@ -42,11 +50,9 @@ func newUpdateCmd() *updateCmd {
 			// This allows to update binares from a repo that contains
 			// multiple tags for different binaries
 
-			// TODO update should check all binaries with a
-			// certain configured parallelism (default 10, can be changed with -p) and report
-			// which binarines could be potentially upgraded.
-			// It's very likely that we have to extend the provider
-			// interface to support this use-case
+			if err := validateJobs(root.opts.jobs); err != nil {
+				return err
+			}
 
 			toUpdate := map[*updateInfo]*config.Binary{}
 			cfg := config.Get()
@@ -66,30 +72,102 @@ func newUpdateCmd() *updateCmd {
 			}
 
 			updateFailures := map[*config.Binary]error{}
+			// rate limited hosts aren't checked again, the
+			// skipped binaries are reported at the end instead
+			rateLimited := map[string]*rateLimitSummary{}
+			// mu guards updateFailures and rateLimited,
+			// which are changed by concurrent tasks
+			var mu sync.Mutex
+
+			// groups are checked once through any of their binaries
+			seenGroups := map[string]bool{}
+
+			paths := make([]string, 0, len(binsToProcess))
+			for p := range binsToProcess {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
 
-			for p, b := range binsToProcess {
-				if cfg.Bins[p].Pinned {
+			var checks []task
+			var checked []*config.Binary
+			var found []*updateInfo
+			for _, p := range paths {
+				b := binsToProcess[p]
+				name := os.ExpandEnv(b.Path)
+				if b.Group != "" {
+					if seenGroups[b.Group] {
+						continue
+					}
+					seenGroups[b.Group] = true
+					if isGroupPinned(b.Group) {
+						log.Infof("%s is a pinned group", b.Group)
+						continue
+					}
+					name = b.Group
+				} else if cfg.Bins[p].Pinned {
 					log.Infof("%s is a pinned binary", p)
 					continue
 				}
-				p, err := providers.New(b.URL, b.Provider)
-				if err != nil {
-					return err
-				}
-				log.Debugf("Using provider '%s' for '%s'", p.GetID(), b.URL)
 
-				if ui, err := getLatestVersion(b, p); err != nil {
-					if root.opts.continueOnError {
-						updateFailures[b] = fmt.Errorf("Error while getting latest version of %v: %v", b.Path, err)
-						continue
+				i := len(checks)
+				checked = append(checked, b)
+				found = append(found, nil)
+				checks = append(checks, task{name: name, run: func() error {
+					mu.Lock()
+					rl, limited := rateLimited[binaryHost(b.URL)]
+					if limited {
+						rl.skipped = append(rl.skipped, b.Path)
 					}
-					return err
-				} else if ui != nil {
-					toUpdate[ui] = b
+					mu.Unlock()
+					if limited {
+						return nil
+					}
+
+					p, err := providers.New(b.URL, b.Provider)
+					if err != nil {
+						return err
+					}
+					log.Debugf("Using provider '%s' for '%s'", p.GetID(), b.URL)
+
+					ui, err := getLatestVersion(b, p)
+					if err != nil {
+						mu.Lock()
+						defer mu.Unlock()
+						var rle *providers.RateLimitError
+						if errors.As(err, &rle) {
+							if rl, ok := rateLimited[rle.Host]; ok {
+								rl.skipped = append(rl.skipped, b.Path)
+							} else {
+								rateLimited[rle.Host] = &rateLimitSummary{err: rle, skipped: []string{b.Path}}
+							}
+							return nil
+						}
+						if root.opts.continueOnError {
+							updateFailures[b] = fmt.Errorf("Error while getting latest version of %v: %v", b.Path, err)
+							return nil
+						}
+						return err
+					}
+					found[i] = ui
+					return nil
+				}})
+			}
+
+			if err := firstError(runTasks(checks, root.opts.jobs, "checked", true)); err != nil {
+				return err
+			}
+			for i, ui := range found {
+				if ui != nil {
+					toUpdate[ui] = checked[i]
 				}
 			}
 
+			rateLimitErr := logRateLimits(rateLimited)
+
 			if len(toUpdate) == 0 && len(updateFailures) == 0 {
+				if rateLimitErr != nil {
+					return rateLimitErr
+				}
 				log.Infof("All binaries are up to date")
 				return nil
 			}
@@ -105,56 +183,42 @@ func newUpdateCmd() *updateCmd {
 				updateFailures = map[*config.Binary]error{}
 
 				err := prompt.Confirm("Do you want to continue?")
+				if errors.Is(err, options.ErrNonInteractive) {
+					return fmt.Errorf("%w, use --yes to update without confirmation", err)
+				}
 				if err != nil {
 					return err
 				}
 			}
 
-			// TODO	:S code smell here, this pretty much does
-			// the same thing as install logic. Refactor to
-			// use the same code in both places
+			var updates []task
 			for ui, b := range toUpdate {
-
-				p, err := providers.New(ui.url, b.Provider)
-				if err != nil {
-					return err
+				name := os.ExpandEnv(b.Path)
+				if b.Group != "" {
+					name = b.Group
 				}
-				log.Debugf("Using provider '%s' for '%s'", p.GetID(), ui.url)
-
-				pResult, err := p.Fetch(&providers.FetchOpts{All: root.opts.all, PackagePath: b.PackagePath, SkipPatchCheck: root.opts.skipPathCheck, PackageName: b.RemoteName})
-				if err != nil {
-					if root.opts.continueOnError {
-						updateFailures[b] = fmt.Errorf("Error while fetching %v: %w", ui.url, err)
-						continue
+				updates = append(updates, task{name: name, run: func() error {
+					err := root.updateBinary(ui, b)
+					var fe *fetchError
+					if errors.As(err, &fe) && root.opts.continueOnError {
+						mu.Lock()
+						updateFailures[b] = err
+						mu.Unlock()
+						return nil
 					}
 					return err
-				}
-
-				hash, err := saveToDisk(pResult, b.Path, true)
-				if err != nil {
-					return fmt.Errorf("error installing binary: %w", err)
-				}
-
-				err = config.UpsertBinary(&config.Binary{
-					RemoteName:  pResult.Name,
-					Path:        b.Path,
-					Version:     pResult.Version,
-					Hash:        fmt.Sprintf("%x", hash),
-					URL:         ui.url,
-					Provider:    p.GetID(),
-					PackagePath: pResult.PackagePath,
-				})
-				if err != nil {
-					return err
-				}
+				}})
+			}
+			sort.Slice(updates, func(i, j int) bool { return updates[i].name < updates[j].name })
 
-				log.Infof("Done updating %s to %s", os.ExpandEnv(b.Path), color.GreenString(ui.version))
+			if err := firstError(runTasks(updates, root.opts.jobs, "updated", true)); err != nil {
+				return err
 			}
 			for _, err := range updateFailures {
 				log.Warnf("%v", err)
 			}
 			// TODO: Return wrapping error with specific exit code if len(updateFailures) > 0?
-			return nil
+			return rateLimitErr
 		},
 	}
 
@@ -164,9 +228,128 @@ func newUpdateCmd() *updateCmd {
 	root.cmd.Flags().BoolVarP(&root.opts.all, "all", "a", false, "Show all possible download options (skip scoring & filtering)")
 	root.cmd.Flags().BoolVarP(&root.opts.skipPathCheck, "skip-path-check", "p", false, "Skips path checking when looking into packages")
 	root.cmd.Flags().BoolVarP(&root.opts.continueOnError, "continue-on-error", "c", false, "Continues to update next package if an error is encountered")
+	root.cmd.Flags().IntVarP(&root.opts.jobs, "jobs", "j", defaultJobs, "Number of binaries checked and updated at once")
 	return root
 }
 
+// fetchError is a failed download of an update, which
+// is skipped with --continue-on-error
+type fetchError struct {
+	err error
+}
+
+func (e *fetchError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fetchError) Unwrap() error {
+	return e.err
+}
+
+// updateBinary installs the version of ui of b, or of its group
+func (root *updateCmd) updateBinary(ui *updateInfo, b *config.Binary) error {
+	// TODO	:S code smell here, this pretty much does
+	// the same thing as install logic. Refactor to
+	// use the same code in both places
+	p, err := providers.New(ui.url, b.Provider)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Using provider '%s' for '%s'", p.GetID(), ui.url)
+
+	pResult, err := p.Fetch(&providers.FetchOpts{All: root.opts.all || b.All, PackagePath: b.PackagePath, SkipPatchCheck: root.opts.skipPathCheck, PackageName: b.RemoteName, NamePattern: b.NamePattern, Files: b.Files, Extras: b.InstallExtras, ScoringRules: b.ScoringRules})
+	if err != nil {
+		return &fetchError{fmt.Errorf("Error while fetching %v: %w", ui.url, err)}
+	}
+
+	if b.Group != "" {
+		if _, err := saveGroup(p, pResult, filepath.Dir(b.Path), b.Group, ui.url, b, true); err != nil {
+			return err
+		}
+		log.Infof("Done updating %s to %s", b.Group, color.GreenString(ui.version))
+		return nil
+	}
+
+	hash, err := saveToDisk(pResult, b.Path, true)
+	if err != nil {
+		closeExtras(pResult.Extras)
+		return fmt.Errorf("error installing binary: %w", err)
+	}
+
+	extras, err := refreshExtras(b, pResult)
+	if err != nil {
+		return err
+	}
+
+	err = config.UpsertBinary(&config.Binary{
+		RemoteName:    pResult.Name,
+		Path:          b.Path,
+		Version:       pResult.Version,
+		Hash:          fmt.Sprintf("%x", hash),
+		URL:           ui.url,
+		Provider:      p.GetID(),
+		PackagePath:   pResult.PackagePath,
+		Digest:        pResult.Digest,
+		NamePattern:   b.NamePattern,
+		All:           b.All,
+		InstallExtras: b.InstallExtras,
+		Extras:        extras,
+		ScoringRules:  b.ScoringRules,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Done updating %s to %s", os.ExpandEnv(b.Path), color.GreenString(ui.version))
+	return nil
+}
+
+type rateLimitSummary struct {
+	err     *providers.RateLimitError
+	skipped []string
+}
+
+// logRateLimits prints which binaries couldn't be checked because of
+// API rate limits and returns an error if there's any
+func logRateLimits(rateLimited map[string]*rateLimitSummary) error {
+	if len(rateLimited) == 0 {
+		return nil
+	}
+
+	hosts := make([]string, 0, len(rateLimited))
+	total := 0
+	for h, rl := range rateLimited {
+		hosts = append(hosts, h)
+		total += len(rl.skipped)
+	}
+	sort.Strings(hosts)
+
+	for _, h := range hosts {
+		rl := rateLimited[h]
+		sort.Strings(rl.skipped)
+		log.Warnf("%v. %d binaries were not checked:", rl.err, len(rl.skipped))
+		for _, p := range rl.skipped {
+			log.Warnf("  %s", p)
+		}
+	}
+	log.Warnf("Configure a token for these hosts to raise the rate limit, or run the update again after the reset time")
+
+	return fmt.Errorf("%d binaries could not be checked because of API rate limits", total)
+}
+
+// binaryHost returns the hostname of the binary URL the same way
+// providers parse it
+func binaryHost(u string) string {
+	if !strings.Contains(u, "://") {
+		u = "https://" + u
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return pu.Hostname()
+}
+
 func getLatestVersion(b *config.Binary, p providers.Provider) (*updateInfo, error) {
 	log.Debugf("Checking updates for %s", b.Path)
 	v, u, err := p.GetLatestVersion()
@@ -0,0 +1,675 @@
+package assets
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/caarlos0/log"
+	"github.com/h2non/filetype"
+	"github.com/h2non/filetype/matchers"
+	"github.com/h2non/filetype/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/krolaw/zipstream"
+	"github.com/marcosnils/bin/pkg/options"
+	"github.com/pierrec/lz4/v4"
+	"github.com/xi2/xz"
+)
+
+// lz4Type isn't known by filetype, the matcher
+// checks the lz4 frame magic number
+var lz4Type = filetype.AddType("lz4", "application/x-lz4")
+
+func init() {
+	filetype.AddMatcher(lz4Type, func(buf []byte) bool {
+		return len(buf) > 3 && buf[0] == 0x04 && buf[1] == 0x22 && buf[2] == 0x4D && buf[3] == 0x18
+	})
+}
+
+// opener returns a new reader positioned at the beginning of the file
+// being processed. Archives are read twice, once to list their contents
+// and once to stream the selected file, so every layer (e.g. the tar
+// inside a .tar.gz) needs to be able to start over.
+type opener func() (io.ReadCloser, error)
+
+// archiveEntry is a file found while listing an archive
+type archiveEntry struct {
+	name string
+	exec bool
+}
+
+// spool copies r into a temp file and returns its path
+func spool(r io.Reader) (string, error) {
+	tmp, err := os.CreateTemp("", "bin-download-*")
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, r); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+func fileOpener(path string) opener {
+	return func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+}
+
+// wrapOpener returns an opener that decodes the output
+// of open with the given decompressor
+func wrapOpener(open opener, decompress func(io.Reader) (io.Reader, error)) opener {
+	return func() (io.ReadCloser, error) {
+		rc, err := open()
+		if err != nil {
+			return nil, err
+		}
+		r, err := decompress(rc)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: r, close: rc.Close}, nil
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r *readCloser) Close() error {
+	return r.close()
+}
+
+// releaseOnEOF calls release once the reader
+// has been completely read or closed
+type releaseOnEOF struct {
+	io.Reader
+	release func()
+	done    bool
+}
+
+func (r *releaseOnEOF) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		r.Close()
+	}
+	return n, err
+}
+
+func (r *releaseOnEOF) Close() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	if c, ok := r.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	r.release()
+	return nil
+}
+
+// lazyReader opens the file on the first read so the
+// members of a group can be streamed one after the other
+type lazyReader struct {
+	open opener
+	rc   io.ReadCloser
+}
+
+func (r *lazyReader) Read(p []byte) (int, error) {
+	if r.rc == nil {
+		rc, err := r.open()
+		if err != nil {
+			return 0, err
+		}
+		r.rc = rc
+	}
+	return r.rc.Read(p)
+}
+
+func (r *lazyReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	return r.rc.Close()
+}
+
+// removeTempFiles removes the downloaded and intermediate files
+func (f *Filter) removeTempFiles() {
+	for _, path := range f.tempFiles {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Debugf("Error removing temp file %s: %v", path, err)
+		}
+	}
+	f.tempFiles = nil
+}
+
+// fileType detects the type of the file returned by open
+func fileType(open opener) (types.Type, error) {
+	rc, err := open()
+	if err != nil {
+		return types.Unknown, err
+	}
+	defer rc.Close()
+
+	head := make([]byte, 8192)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return types.Unknown, err
+	}
+	if n == 0 {
+		return types.Unknown, nil
+	}
+	t, err := filetype.Match(head[:n])
+	// the generic ar matcher might run before the
+	// deb one, since debs are ar archives too
+	if t == matchers.TypeAr && matchers.Archive[matchers.TypeDeb](head[:n]) {
+		return matchers.TypeDeb, err
+	}
+	return t, err
+}
+
+func (f *Filter) processReader(open opener) (*finalFile, error) {
+	t, err := fileType(open)
+	if err != nil {
+		return nil, err
+	}
+
+	type processorFunc func(repoName string, open opener) (*finalFile, opener, error)
+	var processor processorFunc
+	switch t {
+	case matchers.TypeGz:
+		processor = f.processGz
+	case matchers.TypeTar:
+		processor = f.processTar
+	case matchers.TypeXz:
+		processor = f.processXz
+	case matchers.TypeBz2:
+		processor = f.processBz2
+	case matchers.TypeZip:
+		processor = f.processZip
+	case matchers.TypeZstd:
+		processor = f.processZstd
+	case lz4Type:
+		processor = f.processLz4
+	case matchers.Type7z:
+		processor = f.process7z
+	case matchers.TypeDeb:
+		processor = f.processDeb
+	case matchers.TypeRpm:
+		processor = f.processRpm
+	case cpioType:
+		processor = f.processCpio
+	}
+
+	if processor != nil {
+		outFile, next, err := processor(f.repoName, open)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			// a group of files was selected from an archive
+			return outFile, nil
+		}
+
+		f.name = outFile.Name
+		f.packagePath = outFile.PackagePath
+
+		// In case of e.g. a .tar.gz, process the uncompressed archive by calling recursively
+		return f.processReader(next)
+	}
+
+	rc, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &finalFile{Source: rc, Name: f.name, PackagePath: f.packagePath}, nil
+}
+
+// processGz receives a tar.gz file and returns the
+// correct file for bin to download
+func (f *Filter) processGz(name string, open opener) (*finalFile, opener, error) {
+	next := wrapOpener(open, func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	})
+
+	// read the header once to get the original file name
+	rc, err := next()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+
+	return &finalFile{Name: rc.(*readCloser).Reader.(*gzip.Reader).Name}, next, nil
+}
+
+func (f *Filter) processBz2(name string, open opener) (*finalFile, opener, error) {
+	next := wrapOpener(open, func(r io.Reader) (io.Reader, error) {
+		return bzip2.NewReader(r), nil
+	})
+	return &finalFile{Name: name}, next, nil
+}
+
+func (f *Filter) processXz(name string, open opener) (*finalFile, opener, error) {
+	next := wrapOpener(open, func(r io.Reader) (io.Reader, error) {
+		return xz.NewReader(r, 0)
+	})
+	return &finalFile{Name: name}, next, nil
+}
+
+func (f *Filter) processZstd(name string, open opener) (*finalFile, opener, error) {
+	next := func() (io.ReadCloser, error) {
+		rc, err := open()
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zstd.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: zr, close: func() error {
+			zr.Close()
+			return rc.Close()
+		}}, nil
+	}
+	return &finalFile{Name: name}, next, nil
+}
+
+func (f *Filter) processLz4(name string, open opener) (*finalFile, opener, error) {
+	next := wrapOpener(open, func(r io.Reader) (io.Reader, error) {
+		return lz4.NewReader(r), nil
+	})
+	return &finalFile{Name: name}, next, nil
+}
+
+func (f *Filter) processTar(name string, open opener) (*finalFile, opener, error) {
+	if len(f.opts.PackagePath) > 0 {
+		log.Debugf("Processing tag with PackagePath %s\n", f.opts.PackagePath)
+	}
+
+	// first pass, list the files without reading their contents
+	var entries []archiveEntry
+	err := walkTar(open, func(header *tar.Header, _ io.Reader) (bool, error) {
+		if header.Typeflag != tar.TypeReg {
+			return false, nil
+		}
+		entries = append(entries, archiveEntry{name: header.Name, exec: header.FileInfo().Mode()&0o111 != 0})
+		return false, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f.selectFromArchive(name, "tar", entries, func(file string) opener { return tarMember(open, file) })
+}
+
+// tarMember returns an opener that streams selectedFile out of the tar returned by open
+func tarMember(open opener, selectedFile string) opener {
+	return func() (io.ReadCloser, error) {
+		rc, err := open()
+		if err != nil {
+			return nil, err
+		}
+		var found io.Reader
+		err = walkTar(func() (io.ReadCloser, error) { return rc, nil }, func(header *tar.Header, r io.Reader) (bool, error) {
+			if header.Name == selectedFile && header.Typeflag == tar.TypeReg {
+				found = r
+				return true, nil
+			}
+			return false, nil
+		})
+		if err == nil && found == nil {
+			err = fmt.Errorf("file %s not found in tar archive", selectedFile)
+		}
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: found, close: rc.Close}, nil
+	}
+}
+
+// walkTar calls fn for each tar entry until it returns true. The reader
+// opened by walkTar is left open when fn stops the walk so the current
+// entry can still be read.
+func walkTar(open opener, fn func(*tar.Header, io.Reader) (bool, error)) error {
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			rc.Close()
+			return nil
+		} else if err != nil {
+			rc.Close()
+			return err
+		} else if header.FileInfo().IsDir() {
+			continue
+		}
+		if stop, err := fn(header, tr); err != nil || stop {
+			if err != nil {
+				rc.Close()
+			}
+			return err
+		}
+	}
+}
+
+func (f *Filter) processZip(name string, open opener) (*finalFile, opener, error) {
+	if len(f.opts.PackagePath) > 0 {
+		log.Debugf("Processing tag with PackagePath %s\n", f.opts.PackagePath)
+	}
+
+	var entries []archiveEntry
+	err := walkZip(open, func(header *zip.FileHeader, _ io.Reader) bool {
+		entries = append(entries, archiveEntry{name: header.Name, exec: header.Mode()&0o111 != 0})
+		return false
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f.selectFromArchive(name, "zip", entries, func(file string) opener { return zipMember(open, file) })
+}
+
+// zipMember is the zip counterpart of tarMember
+func zipMember(open opener, selectedFile string) opener {
+	return func() (io.ReadCloser, error) {
+		rc, err := open()
+		if err != nil {
+			return nil, err
+		}
+		var found io.Reader
+		err = walkZip(func() (io.ReadCloser, error) { return rc, nil }, func(header *zip.FileHeader, r io.Reader) bool {
+			if header.Name == selectedFile {
+				found = r
+				return true
+			}
+			return false
+		})
+		if err == nil && found == nil {
+			err = fmt.Errorf("file %s not found in zip archive", selectedFile)
+		}
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: found, close: rc.Close}, nil
+	}
+}
+
+// process7z handles 7z archives. Unlike tar and zip they can't be
+// streamed, so the archive is read from a seekable file.
+func (f *Filter) process7z(name string, open opener) (*finalFile, opener, error) {
+	if len(f.opts.PackagePath) > 0 {
+		log.Debugf("Processing tag with PackagePath %s\n", f.opts.PackagePath)
+	}
+
+	path, err := f.seekableFile(open)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sr, err := sevenzip.OpenReader(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []archiveEntry
+	for _, file := range sr.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		entries = append(entries, archiveEntry{name: file.Name, exec: file.Mode()&0o111 != 0})
+	}
+	sr.Close()
+
+	return f.selectFromArchive(name, "7z", entries, func(file string) opener { return sevenZipMember(path, file) })
+}
+
+// sevenZipMember is the 7z counterpart of tarMember
+func sevenZipMember(path, selectedFile string) opener {
+	return func() (io.ReadCloser, error) {
+		sr, err := sevenzip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range sr.File {
+			if file.Name != selectedFile {
+				continue
+			}
+			fr, err := file.Open()
+			if err != nil {
+				sr.Close()
+				return nil, err
+			}
+			return &readCloser{Reader: fr, close: func() error {
+				fr.Close()
+				return sr.Close()
+			}}, nil
+		}
+		sr.Close()
+		return nil, fmt.Errorf("file %s not found in 7z archive", selectedFile)
+	}
+}
+
+// seekableFile returns the path of a file with the contents returned
+// by open. The file is only copied when open doesn't already return
+// a file on disk, the copy is removed along with the download.
+func (f *Filter) seekableFile(open opener) (string, error) {
+	rc, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	if file, ok := rc.(*os.File); ok {
+		return file.Name(), nil
+	}
+	path, err := spool(rc)
+	if err != nil {
+		return "", err
+	}
+	f.tempFiles = append(f.tempFiles, path)
+	return path, nil
+}
+
+// walkZip is the zip counterpart of walkTar
+func walkZip(open opener, fn func(*zip.FileHeader, io.Reader) bool) error {
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	zr := zipstream.NewReader(bufio.NewReader(rc))
+	for {
+		header, err := zr.Next()
+		if err == io.EOF {
+			rc.Close()
+			return nil
+		} else if err != nil {
+			rc.Close()
+			return err
+		} else if header.Mode().IsDir() {
+			continue
+		}
+		if fn(header, zr) {
+			return nil
+		}
+	}
+}
+
+// selectArchiveEntry picks the file to install from the entries of an
+// archive. Executables are preferred, and PackagePath and the file part
+// of NamePattern are honored so updates don't prompt again.
+func (f *Filter) selectArchiveEntry(name, kind string, entries []archiveEntry) (string, error) {
+	checkPath := !f.opts.SkipPathCheck && len(f.opts.PackagePath) > 0
+	if checkPath && strings.Contains(f.opts.NamePattern, "/") {
+		// when the file was moved, the file
+		// part of NamePattern selects it instead
+		checkPath = false
+		for _, e := range entries {
+			checkPath = checkPath || e.name == f.opts.PackagePath
+		}
+		if !checkPath {
+			log.Debugf("%s isn't in the %s archive, using the name pattern %q", f.opts.PackagePath, kind, f.opts.NamePattern)
+		}
+	}
+	var files, execFiles []string
+	for _, e := range entries {
+		if checkPath && e.name != f.opts.PackagePath {
+			continue
+		}
+		files = append(files, e.name)
+		if e.exec {
+			execFiles = append(execFiles, e.name)
+		}
+	}
+	if len(execFiles) > 0 {
+		log.Debugf("Filtering %s candidates to %d executable file(s)", kind, len(execFiles))
+		files = execFiles
+	} else {
+		log.Debugf("No executable files found in %s archive, considering all files", kind)
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no files found in %s archive, use -p flag to manually select . PackagePath [%s]", kind, f.opts.PackagePath)
+	}
+
+	var err error
+	if files, err = f.applyFilePattern(files); err != nil {
+		return "", err
+	}
+
+	as := make([]*Asset, 0, len(files))
+	for _, n := range files {
+		as = append(as, &Asset{Name: n, URL: ""})
+	}
+	// the asset part of NamePattern doesn't apply to archive
+	// files, like the ones of streamed plugin downloads
+	f.namePatternUsed = true
+	choice, picked, err := f.filterAssets(name, as)
+	if ae := (*options.AmbiguousError)(nil); errors.As(err, &ae) {
+		ae.Msg = fmt.Sprintf("%d files of %s match", len(ae.Candidates), f.name)
+		ae.Hint = "Pick one with --name '*/FILE' when installing, or `bin selection <binary> --package-path FILE` for installed binaries"
+	}
+	if err != nil {
+		return "", err
+	}
+	f.pickedFile = picked
+	return choice.String(), nil
+}
+
+// selectFromArchive selects the file, or the group of files, to install
+// from the entries of an archive. The selected files are opened with
+// member, which streams them from the archive.
+func (f *Filter) selectFromArchive(name, kind string, entries []archiveEntry, member func(string) opener) (*finalFile, opener, error) {
+	if f.opts.Extras {
+		f.extras = append(f.extras, archiveExtras(entries, member)...)
+	}
+
+	if len(f.opts.Files) > 0 {
+		out, err := f.archiveGroup(kind, entries, member)
+		return out, nil, err
+	}
+
+	selectedFile, err := f.selectArchiveEntry(name, kind, entries)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// return base of selected file since archives
+	// usually have folders inside
+	return &finalFile{Name: filepath.Base(selectedFile), PackagePath: selectedFile}, member(selectedFile), nil
+}
+
+// archiveGroup selects every file matching the Files patterns. Globs
+// only select executables unless the archive has none, while plain
+// names must match a file. Each member is opened with member once
+// it's read.
+func (f *Filter) archiveGroup(kind string, entries []archiveEntry, member func(string) opener) (*finalFile, error) {
+	var selected []string
+	seen := map[string]bool{}
+	for _, pattern := range f.opts.Files {
+		var matches, execMatches []string
+		for _, e := range entries {
+			matched, err := filepath.Match(pattern, e.name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+			}
+			if !matched {
+				matched, _ = filepath.Match(pattern, filepath.Base(e.name))
+			}
+			if !matched {
+				continue
+			}
+			matches = append(matches, e.name)
+			if e.exec {
+				execMatches = append(execMatches, e.name)
+			}
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files in %s archive matching %q", kind, pattern)
+		}
+		if strings.ContainsAny(pattern, "*?[") && len(execMatches) > 0 {
+			matches = execMatches
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				selected = append(selected, m)
+			}
+		}
+	}
+
+	out := &finalFile{}
+	for _, name := range selected {
+		log.Debugf("Selecting %s from %s archive", name, kind)
+		out.Group = append(out.Group, &GroupMember{Source: &lazyReader{open: member(name)}, Name: filepath.Base(name), PackagePath: name})
+	}
+	out.Source, out.Name, out.PackagePath = out.Group[0].Source, out.Group[0].Name, out.Group[0].PackagePath
+	return out, nil
+}
+
+// applyFilePattern filters files by the path portion of NamePattern (the part
+// after the first slash). Each entry is matched against both its full path and
+// its base name, so "mytool" matches "dir/mytool". If NamePattern has no slash
+// the files are returned unchanged.
+func (f *Filter) applyFilePattern(files []string) ([]string, error) {
+	idx := strings.Index(f.opts.NamePattern, "/")
+	if idx < 0 {
+		return files, nil
+	}
+	filePattern := f.opts.NamePattern[idx+1:]
+	var filtered []string
+	for _, n := range files {
+		matched, err := filepath.Match(filePattern, n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path pattern %q: %w", filePattern, err)
+		}
+		if !matched {
+			if matched, err = filepath.Match(filePattern, filepath.Base(n)); err != nil {
+				return nil, fmt.Errorf("invalid path pattern %q: %w", filePattern, err)
+			}
+		}
+		if matched {
+			filtered = append(filtered, n)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no files in archive matching pattern %q", filePattern)
+	}
+	return filtered, nil
+}
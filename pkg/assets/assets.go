@@ -1,29 +1,25 @@
 package assets
 
 import (
-	"archive/tar"
-	"bytes"
-	"compress/bzip2"
-	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/caarlos0/log"
-	"github.com/cheggaaa/pb"
 	"github.com/h2non/filetype"
 	"github.com/h2non/filetype/matchers"
 	"github.com/h2non/filetype/types"
-	"github.com/krolaw/zipstream"
+	"github.com/marcosnils/bin/pkg/cache"
 	"github.com/marcosnils/bin/pkg/config"
-	"github.com/marcosnils/bin/pkg/httpclient"
 	"github.com/marcosnils/bin/pkg/options"
 	bstrings "github.com/marcosnils/bin/pkg/strings"
-	"github.com/xi2/xz"
 )
 
 var (
@@ -38,6 +34,11 @@ type Asset struct {
 	// outputs for bin
 	DisplayName string
 	URL         string
+	// Size in bytes, 0 if the provider doesn't know it
+	Size int64
+	// Digest is the hex encoded sha256 of the
+	// asset, if the provider reports it
+	Digest string
 }
 
 func (g Asset) String() string {
@@ -52,6 +53,8 @@ type FilteredAsset struct {
 	Name         string
 	DisplayName  string
 	URL          string
+	Size         int64
+	Digest       string
 	score        int
 	ExtraHeaders map[string]string
 }
@@ -60,12 +63,39 @@ type finalFile struct {
 	Source      io.Reader
 	Name        string
 	PackagePath string
+	// Group holds every file selected from an archive when
+	// FilterOpts.Files is set, the fields above are its first member
+	Group []*GroupMember
+	// Extras are the completions and man pages found when
+	// FilterOpts.Extras is set
+	Extras []*ExtraFile
+	// Digest is the sha256 of the downloaded asset, empty
+	// for the ones that aren't downloaded by ProcessURL
+	Digest string
+	// PickedAsset and PickedFile are set when the asset or
+	// the archive file were picked from a prompt
+	PickedAsset bool
+	PickedFile  bool
+}
+
+// GroupMember is one of the files installed together
+// from the same archive
+type GroupMember struct {
+	Source      io.Reader
+	Name        string
+	PackagePath string
 }
 
 type platformResolver interface {
 	GetOS() []string
 	GetArch() []string
+	// GetArchVariants returns the score of the variants of
+	// the architecture, see config.GetArchVariants
+	GetArchVariants() map[string]int
 	GetOSSpecificExtensions() []string
+	// GetLibc returns config.LibcGlibc, config.LibcMusl
+	// or an empty string if it's unknown
+	GetLibc() string
 }
 
 type Filter struct {
@@ -74,6 +104,14 @@ type Filter struct {
 	name            string
 	packagePath     string
 	namePatternUsed bool
+	// pickedAsset and pickedFile are set when the
+	// asset or the archive file were picked from a prompt
+	pickedAsset bool
+	pickedFile  bool
+	// tempFiles are removed once the resulting file is read
+	tempFiles []string
+	extras    []*ExtraFile
+	rules     []*scoringRule
 }
 
 type FilterOpts struct {
@@ -94,8 +132,21 @@ type FilterOpts struct {
 	// and the part after matches files inside archives. Without a slash the
 	// whole pattern matches top-level asset names only.
 	NamePattern string
+
+	// Files are glob patterns (or names) of archive files to install
+	// together as a group instead of selecting a single file
+	Files []string
+
+	// Extras looks for shell completions and man pages in archives
+	Extras bool
+
+	// ScoringRules of the binary, applied after the global
+	// rules in the config
+	ScoringRules []*config.ScoringRule
 }
 
+// runtimeResolver resolves the platform of the config, which
+// is the host one unless a target was set (see config.Target)
 type runtimeResolver struct{}
 
 func (runtimeResolver) GetOS() []string {
@@ -106,12 +157,40 @@ func (runtimeResolver) GetArch() []string {
 	return config.GetArch()
 }
 
+func (runtimeResolver) GetArchVariants() map[string]int {
+	return config.GetArchVariants()
+}
+
 func (runtimeResolver) GetOSSpecificExtensions() []string {
 	return config.GetOSSpecificExtensions()
 }
 
+func (runtimeResolver) GetLibc() string {
+	return config.GetLibc()
+}
+
+// libcTokens are the words used in asset names built for each libc.
+// Assets built for the host libc score higher and the ones built for
+// a different libc are penalised.
+var libcTokens = map[string][]string{
+	config.LibcGlibc: {"gnu", "glibc"},
+	config.LibcMusl:  {"musl"},
+}
+
 var resolver platformResolver = runtimeResolver{}
 
+// Preview shows the size and score of the asset in the picker
+func (g FilteredAsset) Preview() string {
+	var details []string
+	if g.Size > 0 {
+		details = append(details, bstrings.HumanSize(g.Size))
+	}
+	if g.score != 0 {
+		details = append(details, fmt.Sprintf("score %d", g.score))
+	}
+	return strings.Join(details, ", ")
+}
+
 func (g FilteredAsset) String() string {
 	if g.DisplayName != "" {
 		return g.DisplayName
@@ -126,11 +205,24 @@ func NewFilter(opts *FilterOpts) *Filter {
 // FilterAssets receives a slice of assets and tries to select the proper one,
 // prompting the user to choose manually when it can't determine a single match.
 func (f *Filter) FilterAssets(repoName string, as []*Asset) (*FilteredAsset, error) {
+	as, err := f.applyExcludeRules(as)
+	if err != nil {
+		return nil, err
+	}
+	fa, picked, err := f.filterAssets(repoName, as)
+	f.pickedAsset = picked
+	return fa, err
+}
+
+// filterAssets selects one of as like FilterAssets without applying
+// the exclude rules, which are only meant for release assets. It
+// reports whether the user picked it from a prompt.
+func (f *Filter) filterAssets(repoName string, as []*Asset) (*FilteredAsset, bool, error) {
+	var err error
 	if f.opts.NamePattern != "" && !f.namePatternUsed {
-		var err error
 		as, err = f.applyNamePattern(as)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 	}
 
@@ -138,7 +230,7 @@ func (f *Filter) FilterAssets(repoName string, as []*Asset) (*FilteredAsset, err
 		for _, a := range as {
 			if a.Name == f.opts.PackageName {
 				log.Debugf("Asset %q matches PackageName exactly, selecting automatically", a.Name)
-				return &FilteredAsset{RepoName: repoName, Name: a.Name, DisplayName: a.DisplayName, URL: a.URL}, nil
+				return &FilteredAsset{RepoName: repoName, Name: a.Name, DisplayName: a.DisplayName, URL: a.URL, Size: a.Size, Digest: a.Digest}, false, nil
 			}
 		}
 	}
@@ -147,7 +239,7 @@ func (f *Filter) FilterAssets(repoName string, as []*Asset) (*FilteredAsset, err
 	switch {
 	case len(as) == 1:
 		a := as[0]
-		matches = []*FilteredAsset{{RepoName: repoName, Name: a.Name, URL: a.URL}}
+		matches = []*FilteredAsset{{RepoName: repoName, Name: a.Name, URL: a.URL, Size: a.Size, Digest: a.Digest}}
 	case f.opts.SkipScoring:
 		log.Debugf("--all flag was supplied, skipping scoring")
 		matches = toFilteredAssets(repoName, as)
@@ -155,7 +247,9 @@ func (f *Filter) FilterAssets(repoName string, as []*Asset) (*FilteredAsset, err
 		matches = f.scoreAssets(repoName, as)
 	}
 
-	return selectCandidate(matches, toFilteredAssets(repoName, as))
+	choice, err := selectCandidate(matches, toFilteredAssets(repoName, as))
+	// selectCandidate only prompts when several assets match
+	return choice, err == nil && len(matches) > 1, err
 }
 
 // applyNamePattern filters assets to those matching the asset portion of
@@ -186,7 +280,7 @@ func (f *Filter) applyNamePattern(as []*Asset) ([]*Asset, error) {
 func toFilteredAssets(repoName string, as []*Asset) []*FilteredAsset {
 	out := make([]*FilteredAsset, len(as))
 	for i, a := range as {
-		out[i] = &FilteredAsset{RepoName: repoName, Name: a.Name, DisplayName: a.DisplayName, URL: a.URL}
+		out[i] = &FilteredAsset{RepoName: repoName, Name: a.Name, DisplayName: a.DisplayName, URL: a.URL, Size: a.Size, Digest: a.Digest}
 	}
 	return out
 }
@@ -194,55 +288,143 @@ func toFilteredAssets(repoName string, as []*Asset) []*FilteredAsset {
 // scoreAssets scores each asset by OS/arch/extension relevance and returns
 // only those tied for the highest score.
 func (f *Filter) scoreAssets(repoName string, as []*Asset) []*FilteredAsset {
-	scores := map[string]int{repoName: 1}
+	scores := map[string]int{}
 	for _, os := range resolver.GetOS() {
 		scores[os] = 10
 	}
 	for _, arch := range resolver.GetArch() {
 		scores[arch] = 5
 	}
+	for variant, score := range resolver.GetArchVariants() {
+		scores[variant] = score
+	}
 	for _, ext := range resolver.GetOSSpecificExtensions() {
 		scores[ext] = 15
 	}
+	if hostLibc := resolver.GetLibc(); hostLibc != "" {
+		for libc, tokens := range libcTokens {
+			score := -3
+			if libc == hostLibc {
+				score = 2
+			}
+			for _, token := range tokens {
+				scores[token] = score
+			}
+		}
+	}
 
 	scoreKeys := make([]string, 0, len(scores))
 	for key := range scores {
 		scoreKeys = append(scoreKeys, strings.ToLower(key))
 	}
 
+	matches := f.scoreCandidates(repoName, as, scores, scoreKeys, isSupportedExt)
+	// packages are only used when no archive
+	// or binary was built for the host OS
+	if !anyForHostOS(matches) {
+		if packages := f.scoreCandidates(repoName, as, scores, scoreKeys, isPackageExt); len(packages) > 0 {
+			log.Debugf("No archives or binaries matched the host OS, considering .deb and .rpm packages")
+			matches = packages
+		}
+	}
+	return keepHighestScored(matches)
+}
+
+// anyForHostOS checks if the name of any of the
+// matches has the host OS or one of its extensions
+func anyForHostOS(matches []*FilteredAsset) bool {
+	var tokens []string
+	for _, os := range resolver.GetOS() {
+		tokens = append(tokens, strings.ToLower(os))
+	}
+	for _, ext := range resolver.GetOSSpecificExtensions() {
+		tokens = append(tokens, strings.ToLower(ext))
+	}
+	for _, m := range matches {
+		if bstrings.ContainsAny(strings.ToLower(m.Name), tokens) {
+			return true
+		}
+	}
+	return false
+}
+
+// scoreCandidates scores the assets accepted by supported, adding
+// the points of the matching scoring rules and one point for the
+// repo name
+func (f *Filter) scoreCandidates(repoName string, as []*Asset, scores map[string]int, scoreKeys []string, supported func(string) bool) []*FilteredAsset {
 	var matches []*FilteredAsset
 	for _, a := range as {
-		if s := scoreAsset(a.Name, scores, scoreKeys); s > 0 {
-			matches = append(matches, &FilteredAsset{RepoName: repoName, Name: a.Name, DisplayName: a.DisplayName, URL: a.URL, score: s})
+		if !supported(a.Name) {
+			continue
+		}
+		// rules only adjust the score of the assets that match the
+		// platform, so they don't bring back the ones for other platforms
+		s := scoreAsset(a.Name, scores, scoreKeys)
+		if s > 0 {
+			s += f.ruleScore(a.Name)
+		}
+		if strings.Contains(strings.ToLower(a.Name), strings.ToLower(repoName)) {
+			log.Debugf("Candidate %s contains %s. Adding score %d", a.Name, repoName, 1)
+			s++
+		}
+		if s > 0 {
+			matches = append(matches, &FilteredAsset{RepoName: repoName, Name: a.Name, DisplayName: a.DisplayName, URL: a.URL, Size: a.Size, Digest: a.Digest, score: s})
 		}
 	}
-	return keepHighestScored(matches)
+	return matches
 }
 
 // scoreAsset returns the total score for a single asset name, or 0 if it
-// doesn't qualify (unsupported extension or no keyword matches).
+// doesn't qualify (no keyword matches).
 func scoreAsset(name string, scores map[string]int, scoreKeys []string) int {
-	if !bstrings.ContainsAny(strings.ToLower(name), scoreKeys) || !isSupportedExt(name) {
+	if !bstrings.ContainsAny(strings.ToLower(name), scoreKeys) {
 		return 0
 	}
 	total := 0
 	for toMatch, score := range scores {
-		if strings.Contains(strings.ToLower(name), strings.ToLower(toMatch)) {
-			log.Debugf("Candidate %s contains %s. Adding score %d", name, toMatch, score)
-			total += score
+		if !strings.Contains(strings.ToLower(name), strings.ToLower(toMatch)) {
+			continue
 		}
+		if longerArchMatch(name, toMatch) {
+			continue
+		}
+		log.Debugf("Candidate %s contains %s. Adding score %d", name, toMatch, score)
+		total += score
 	}
 	return total
 }
 
-// keepHighestScored filters matches down to those tied for the top score.
-func keepHighestScored(matches []*FilteredAsset) []*FilteredAsset {
+// longerArchMatch checks if name contains another name of the
+// architecture that contains arch, so overlapping names are only
+// scored once, for the longest one
+func longerArchMatch(name, arch string) bool {
+	aliases := resolver.GetArch()
+	if !slices.ContainsFunc(aliases, func(a string) bool { return strings.EqualFold(a, arch) }) {
+		return false
+	}
+	name, arch = strings.ToLower(name), strings.ToLower(arch)
+	for _, a := range aliases {
+		a = strings.ToLower(a)
+		if a != arch && strings.Contains(a, arch) && strings.Contains(name, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func highestScore(matches []*FilteredAsset) int {
 	highest := 0
 	for _, m := range matches {
 		if m.score > highest {
 			highest = m.score
 		}
 	}
+	return highest
+}
+
+// keepHighestScored filters matches down to those tied for the top score.
+func keepHighestScored(matches []*FilteredAsset) []*FilteredAsset {
+	highest := highestScore(matches)
 	var out []*FilteredAsset
 	for _, m := range matches {
 		if m.score >= highest {
@@ -273,10 +455,17 @@ func selectCandidate(matches []*FilteredAsset, allAssets []*FilteredAsset) (*Fil
 	sort.SliceStable(generic, func(i, j int) bool {
 		return generic[i].String() < generic[j].String()
 	})
+	if !options.Interactive() {
+		return nil, options.NewAmbiguousError(fmt.Sprintf("%d candidates match", len(matches)), generic,
+			"Pick one with --name 'GLOB' when installing, or `bin selection <binary> --name 'GLOB'` for installed binaries")
+	}
 	if len(allAssets) > len(matches) {
 		generic = append(generic, options.LiteralStringer("Show all"))
 	}
-	choice, err := options.Select("Showing "+strconv.Itoa(len(matches))+" assets out of "+strconv.Itoa(len(allAssets))+". Select an option ", generic)
+	// the lock is held until the asset is picked from all
+	// of them too, so other prompts don't come in between
+	defer options.LockPrompts()()
+	choice, err := options.SelectLocked("Showing "+strconv.Itoa(len(matches))+" assets out of "+strconv.Itoa(len(allAssets))+". Select an option ", generic)
 	if err != nil {
 		return nil, err
 	}
@@ -288,7 +477,7 @@ func selectCandidate(matches []*FilteredAsset, allAssets []*FilteredAsset) (*Fil
 		sort.SliceStable(all, func(i, j int) bool {
 			return all[i].String() < all[j].String()
 		})
-		choice, err = options.Select("Select from all available assets:", all)
+		choice, err = options.SelectLocked("Select from all available assets:", all)
 		if err != nil {
 			return nil, err
 		}
@@ -304,9 +493,24 @@ func SanitizeName(name, version string) string {
 
 	// TODO maybe instead of doing this put everything in a map (set) and then
 	// generate the replacements? IDK.
+	// variants go first so they're removed as a whole, e.g. armv7 before arm
+	var archNames []string
+	for variant, score := range resolver.GetArchVariants() {
+		if score > 0 {
+			archNames = append(archNames, variant)
+		}
+	}
+	sort.Slice(archNames, func(i, j int) bool {
+		if len(archNames[i]) != len(archNames[j]) {
+			return len(archNames[i]) > len(archNames[j])
+		}
+		return archNames[i] < archNames[j]
+	})
+	archNames = append(archNames, resolver.GetArch()...)
+
 	firstPass := true
 	for _, osName := range resolver.GetOS() {
-		for _, archName := range resolver.GetArch() {
+		for _, archName := range archNames {
 			replacements = append(replacements, "_"+osName+archName, "")
 			replacements = append(replacements, "-"+osName+archName, "")
 			replacements = append(replacements, "."+osName+archName, "")
@@ -337,274 +541,118 @@ func SanitizeName(name, version string) string {
 // ProcessURL processes a FilteredAsset by uncompressing/unarchiving the URL of the asset.
 func (f *Filter) ProcessURL(gf *FilteredAsset) (*finalFile, error) {
 	f.name = gf.Name
-	// We're not closing the body here since the caller is in charge of that
-	req, err := http.NewRequest(http.MethodGet, gf.URL, nil)
+	req, err := http.NewRequest(http.MethodGet, config.RewriteURL(gf.URL), nil)
 	if err != nil {
 		return nil, err
 	}
 	for name, value := range gf.ExtraHeaders {
 		req.Header.Add(name, value)
 	}
-	log.Debugf("Checking binary from %s", gf.URL)
-	res, err := httpclient.Client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	if res.StatusCode > 299 || res.StatusCode < 200 {
-		return nil, fmt.Errorf("%d response when checking binary from %s", res.StatusCode, gf.URL)
+	e, path, cached := cache.Lookup(gf.URL, gf.Size, gf.Digest)
+	switch {
+	case cached && gf.Digest != "":
+		return f.processCached(gf, e, path)
+	case cached && e.ETag != "":
+		// the content of the URL might have changed since it
+		// was cached, the server tells if it did
+		req.Header.Set("If-None-Match", e.ETag)
+	case cached:
+		log.Debugf("Not reusing the cached download of %s, it can't be revalidated", gf.Name)
+		cached = false
+	}
+
+	// The download is spooled to a temp file so archives can be
+	// read twice (once to list their contents and once to extract
+	// the selected file) without keeping them in memory
+	tmp, digest, etag, err := download(req)
+	if cached && errors.Is(err, errNotModified) {
+		return f.processCached(gf, e, path)
 	}
-
-	// We're caching the whole file into memory so we can prompt
-	// the user which file they want to download
-
-	log.Infof("Starting download of %s", gf.URL)
-	bar := pb.Full.Start64(res.ContentLength)
-	barReader := bar.NewProxyReader(res.Body)
-	defer bar.Finish()
-	buf := new(bytes.Buffer)
-	_, err = io.Copy(buf, barReader)
 	if err != nil {
 		return nil, err
 	}
-	bar.Finish()
-	return f.processReader(buf)
-}
-
-func (f *Filter) processReader(r io.Reader) (*finalFile, error) {
-	var buf bytes.Buffer
-	tee := io.TeeReader(r, &buf)
 
-	t, err := filetype.MatchReader(tee)
+	if err := cache.Store(gf.URL, gf.Name, tmp, digest, etag); err != nil {
+		log.Debugf("Error caching the download of %s: %v", gf.Name, err)
+	}
+	out, err := f.processTempFile(tmp)
 	if err != nil {
 		return nil, err
 	}
-
-	outputFile := io.MultiReader(&buf, r)
-
-	type processorFunc func(repoName string, r io.Reader) (*finalFile, error)
-	var processor processorFunc
-	switch t {
-	case matchers.TypeGz:
-		processor = f.processGz
-	case matchers.TypeTar:
-		processor = f.processTar
-	case matchers.TypeXz:
-		processor = f.processXz
-	case matchers.TypeBz2:
-		processor = f.processBz2
-	case matchers.TypeZip:
-		processor = f.processZip
-	}
-
-	if processor != nil {
-		// log.Debugf("Processing %s file %s with %s", repoName, name, runtime.FuncForPC(reflect.ValueOf(processor).Pointer()).Name())
-		outFile, err := processor(f.repoName, outputFile)
-		if err != nil {
-			return nil, err
-		}
-
-		outputFile = outFile.Source
-
-		f.name = outFile.Name
-		f.packagePath = outFile.PackagePath
-
-		// In case of e.g. a .tar.gz, process the uncompressed archive by calling recursively
-		return f.processReader(outputFile)
-	}
-
-	return &finalFile{Source: outputFile, Name: f.name, PackagePath: f.packagePath}, err
+	out.Digest = digest
+	return out, nil
 }
 
-// processGz receives a tar.gz file and returns the
-// correct file for bin to download
-func (f *Filter) processGz(name string, r io.Reader) (*finalFile, error) {
-	gr, err := gzip.NewReader(r)
+// processCached processes the cached download of gf at path
+func (f *Filter) processCached(gf *FilteredAsset, e *cache.Entry, path string) (*finalFile, error) {
+	log.Infof("Using the cached download of %s", gf.Name)
+	out, err := f.processLocalFile(path)
 	if err != nil {
 		return nil, err
 	}
-
-	return &finalFile{Source: gr, Name: gr.Name}, nil
+	out.Digest = e.Digest
+	return out, nil
 }
 
-func (f *Filter) processTar(name string, r io.Reader) (*finalFile, error) {
-	tr := tar.NewReader(r)
-	tarFiles := map[string][]byte{}
-	if len(f.opts.PackagePath) > 0 {
-		log.Debugf("Processing tag with PackagePath %s\n", f.opts.PackagePath)
-	}
-	execFiles := map[string][]byte{}
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, err
-		} else if header.FileInfo().IsDir() {
-			continue
-		}
-
-		if !f.opts.SkipPathCheck && len(f.opts.PackagePath) > 0 && header.Name != f.opts.PackagePath {
-			continue
-		}
-
-		if header.Typeflag == tar.TypeReg {
-			// TODO we're basically reading all the files
-			// isn't there a way just to store the reference
-			// where this data is so we don't have to do this or
-			// re-scan the archive twice afterwards?
-			bs, err := io.ReadAll(tr)
-			if err != nil {
-				return nil, err
-			}
-			tarFiles[header.Name] = bs
-			if header.FileInfo().Mode()&0o111 != 0 {
-				execFiles[header.Name] = bs
-			}
-		}
-	}
-	if len(execFiles) > 0 {
-		log.Debugf("Filtering tar candidates to %d executable file(s)", len(execFiles))
-		tarFiles = execFiles
-	} else {
-		log.Debugf("No executable files found in tar archive, considering all files")
+// ProcessReader processes an already opened file named name by
+// uncompressing/unarchiving it the same way ProcessURL does.
+func (f *Filter) ProcessReader(name string, r io.Reader) (*finalFile, error) {
+	f.name = name
+	if file, ok := r.(*os.File); ok {
+		// local files can be re-opened, no need to copy them
+		return f.processLocalFile(file.Name())
 	}
-	if len(tarFiles) == 0 {
-		return nil, fmt.Errorf("no files found in tar archive, use -p flag to manually select . PackagePath [%s]", f.opts.PackagePath)
-	}
-
-	var err error
-	if tarFiles, err = f.applyFilePattern(tarFiles); err != nil {
-		return nil, err
-	}
-
-	as := make([]*Asset, 0)
-	for f := range tarFiles {
-		as = append(as, &Asset{Name: f, URL: ""})
-	}
-	choice, err := f.FilterAssets(name, as)
+	tmp, err := spool(r)
 	if err != nil {
 		return nil, err
 	}
-	selectedFile := choice.String()
-
-	tf := tarFiles[selectedFile]
-
-	return &finalFile{Source: bytes.NewReader(tf), Name: filepath.Base(selectedFile), PackagePath: selectedFile}, nil
+	return f.processTempFile(tmp)
 }
 
-func (f *Filter) processBz2(name string, r io.Reader) (*finalFile, error) {
-	br := bzip2.NewReader(r)
-
-	return &finalFile{Source: br, Name: name}, nil
+// processTempFile processes the spooled file at path and
+// removes it once the resulting files have been read
+func (f *Filter) processTempFile(path string) (*finalFile, error) {
+	f.tempFiles = append(f.tempFiles, path)
+	return f.processLocalFile(path)
 }
 
-func (f *Filter) processXz(name string, r io.Reader) (*finalFile, error) {
-	xr, err := xz.NewReader(r, 0)
+// processLocalFile processes the file at path. Temp files
+// created while processing it are removed once the resulting
+// files have been read
+func (f *Filter) processLocalFile(path string) (*finalFile, error) {
+	out, err := f.processReader(fileOpener(path))
 	if err != nil {
+		f.removeTempFiles()
 		return nil, err
 	}
+	out.Extras = f.extras
+	out.PickedAsset, out.PickedFile = f.pickedAsset, f.pickedFile
 
-	return &finalFile{Source: xr, Name: name}, nil
-}
-
-func (f *Filter) processZip(name string, r io.Reader) (*finalFile, error) {
-	zr := zipstream.NewReader(r)
-
-	zipFiles := map[string][]byte{}
-	zipExecFiles := map[string][]byte{}
-	if len(f.opts.PackagePath) > 0 {
-		log.Debugf("Processing tag with PackagePath %s\n", f.opts.PackagePath)
-	}
-	for {
-		header, err := zr.Next()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, err
-		} else if header.Mode().IsDir() {
-			continue
-		}
-
-		if !f.opts.SkipPathCheck && len(f.opts.PackagePath) > 0 && header.Name != f.opts.PackagePath {
-			continue
-		}
-
-		// TODO we're basically reading all the files
-		// isn't there a way just to store the reference
-		// where this data is so we don't have to do this or
-		// re-scan the archive twice afterwards?
-		bs, err := io.ReadAll(zr)
-		if err != nil {
-			return nil, err
-		}
-
-		zipFiles[header.Name] = bs
-		if header.Mode()&0o111 != 0 {
-			zipExecFiles[header.Name] = bs
+	sources := []*io.Reader{&out.Source}
+	if len(out.Group) > 0 {
+		sources = sources[:0]
+		for _, m := range out.Group {
+			sources = append(sources, &m.Source)
 		}
 	}
-	if len(zipExecFiles) > 0 {
-		log.Debugf("Filtering zip candidates to %d executable file(s)", len(zipExecFiles))
-		zipFiles = zipExecFiles
-	} else {
-		log.Debugf("No executable files found in zip archive, considering all files")
-	}
-	if len(zipFiles) == 0 {
-		return nil, fmt.Errorf("No files found in zip archive. PackagePath [%s]", f.opts.PackagePath)
+	for _, e := range out.Extras {
+		sources = append(sources, &e.Source)
 	}
 
-	var err error
-	if zipFiles, err = f.applyFilePattern(zipFiles); err != nil {
-		return nil, err
-	}
-
-	as := make([]*Asset, 0)
-	for f := range zipFiles {
-		as = append(as, &Asset{Name: f, URL: ""})
-	}
-	choice, err := f.FilterAssets(name, as)
-	if err != nil {
-		return nil, err
-	}
-	selectedFile := choice.String()
-
-	fr := bytes.NewReader(zipFiles[selectedFile])
-
-	// return base of selected file since tar
-	// files usually have folders inside
-	return &finalFile{Name: filepath.Base(selectedFile), Source: fr, PackagePath: selectedFile}, nil
-}
-
-// applyFilePattern filters files by the path portion of NamePattern (the part
-// after the first slash). Each entry is matched against both its full path and
-// its base name, so "mytool" matches "dir/mytool". If NamePattern has no slash
-// the map is returned unchanged.
-func (f *Filter) applyFilePattern(files map[string][]byte) (map[string][]byte, error) {
-	idx := strings.Index(f.opts.NamePattern, "/")
-	if idx < 0 {
-		return files, nil
-	}
-	filePattern := f.opts.NamePattern[idx+1:]
-	filtered := make(map[string][]byte)
-	for n, data := range files {
-		matched, err := filepath.Match(filePattern, n)
-		if err != nil {
-			return nil, fmt.Errorf("invalid path pattern %q: %w", filePattern, err)
-		}
-		if !matched {
-			if matched, err = filepath.Match(filePattern, filepath.Base(n)); err != nil {
-				return nil, fmt.Errorf("invalid path pattern %q: %w", filePattern, err)
-			}
-		}
-		if matched {
-			filtered[n] = data
+	// the temp files are removed after the last file is read
+	remaining := len(sources)
+	release := func() {
+		if remaining--; remaining == 0 {
+			f.removeTempFiles()
 		}
 	}
-	if len(filtered) == 0 {
-		return nil, fmt.Errorf("no files in archive matching pattern %q", filePattern)
+	for _, s := range sources {
+		*s = &releaseOnEOF{Reader: *s, release: release}
+	}
+	if len(out.Group) > 0 {
+		out.Source = out.Group[0].Source
 	}
-	return filtered, nil
+	return out, nil
 }
 
 // isSupportedExt checks if this provider supports
@@ -637,7 +685,8 @@ func isSupportedExt(filename string) bool {
 		case msiType, matchers.TypeDeb, matchers.TypeRpm, ascType:
 			log.Debugf("Filename %s doesn't have a supported extension", filename)
 			return false
-		case matchers.TypeGz, types.Unknown, matchers.TypeZip, matchers.TypeXz, matchers.TypeTar, matchers.TypeBz2, matchers.TypeExe:
+		case matchers.TypeGz, types.Unknown, matchers.TypeZip, matchers.TypeXz, matchers.TypeTar, matchers.TypeBz2, matchers.TypeExe,
+			matchers.TypeZstd, matchers.Type7z, lz4Type:
 			break
 		default:
 			log.Debugf("Filename %s doesn't have a supported extension", filename)
@@ -4,15 +4,31 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/options"
+	"github.com/pierrec/lz4/v4"
 )
 
 type mockOSResolver struct {
 	OS                   []string
 	Arch                 []string
+	ArchVariants         map[string]int
 	OSSpecificExtensions []string
+	Libc                 string
 }
 
 func (m *mockOSResolver) GetOS() []string {
@@ -23,10 +39,26 @@ func (m *mockOSResolver) GetArch() []string {
 	return m.Arch
 }
 
+func (m *mockOSResolver) GetArchVariants() map[string]int {
+	return m.ArchVariants
+}
+
 func (m *mockOSResolver) GetOSSpecificExtensions() []string {
 	return m.OSSpecificExtensions
 }
 
+func (m *mockOSResolver) GetLibc() string {
+	return m.Libc
+}
+
+func mustParseTarget(goos, arch, libc string) *config.Target {
+	t, err := config.ParseTarget(goos, arch, libc)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
 var (
 	testLinuxAMDResolver   = &mockOSResolver{OS: []string{"linux"}, Arch: []string{"amd64", "x86_64", "x64", "64"}, OSSpecificExtensions: []string{"AppImage"}}
 	testWindowsAMDResolver = &mockOSResolver{OS: []string{"windows", "win"}, Arch: []string{"amd64", "x86_64", "x64", "64"}, OSSpecificExtensions: []string{"exe"}}
@@ -47,6 +79,9 @@ func TestSanitizeName(t *testing.T) {
 		{"launchpad-linux-x64", "1.2.0-rc.1", "launchpad", testLinuxAMDResolver},
 		{"launchpad-win-x64.exe", "1.2.0-rc.1", "launchpad.exe", testWindowsAMDResolver},
 		{"bin_0.0.1_Windows_x86_64.exe", "0.0.1", "bin.exe", testWindowsAMDResolver},
+		{"tool-linux-armv7", "v1.0.0", "tool", mustParseTarget("linux", "armv7", "")},
+		{"tool_1.0.0_linux_arm64", "v1.0.0", "tool", mustParseTarget("linux", "aarch64", "musl")},
+		{"tool-darwin-x86_64", "v1.0.0", "tool", mustParseTarget("macos", "amd64", "")},
 	}
 
 	for _, c := range cases {
@@ -150,6 +185,18 @@ func TestFilterAssets(t *testing.T) {
 		{args{"cli", []*Asset{
 			{Name: "dapr", URL: ""},
 		}}, "dapr", testLinuxAMDResolver},
+		{args{"tool", []*Asset{
+			{Name: "tool_1.0.0_linux_amd64.deb", URL: "https://example.com/tool_1.0.0_linux_amd64.deb"},
+			{Name: "tool_1.0.0_linux_amd64.tar.gz", URL: "https://example.com/tool_1.0.0_linux_amd64.tar.gz"},
+		}}, "tool_1.0.0_linux_amd64.tar.gz", testLinuxAMDResolver},
+		{args{"tool", []*Asset{
+			{Name: "tool_1.0.0_linux_amd64.deb", URL: "https://example.com/tool_1.0.0_linux_amd64.deb"},
+			{Name: "tool_1.0.0_windows_amd64.zip", URL: "https://example.com/tool_1.0.0_windows_amd64.zip"},
+		}}, "tool_1.0.0_linux_amd64.deb", testLinuxAMDResolver},
+		{args{"tool", []*Asset{
+			{Name: "tool_linux_amd64.deb", URL: "https://example.com/tool_linux_amd64.deb"},
+			{Name: "tool-linux.tar.gz", URL: "https://example.com/tool-linux.tar.gz"},
+		}}, "tool-linux.tar.gz", testLinuxAMDResolver},
 	}
 
 	f := NewFilter(&FilterOpts{SkipScoring: false})
@@ -204,6 +251,234 @@ func TestFilterAssetsNamePattern(t *testing.T) {
 	}
 }
 
+func TestFilterAssetsLibc(t *testing.T) {
+	as := []*Asset{
+		{Name: "tool-x86_64-unknown-linux-gnu.tar.gz"},
+		{Name: "tool-x86_64-unknown-linux-musl.tar.gz"},
+		{Name: "tool-x86_64-pc-windows-msvc.zip"},
+	}
+	cases := map[string]string{
+		config.LibcMusl:  "tool-x86_64-unknown-linux-musl.tar.gz",
+		config.LibcGlibc: "tool-x86_64-unknown-linux-gnu.tar.gz",
+	}
+	for libc, want := range cases {
+		resolver = &mockOSResolver{OS: []string{"linux"}, Arch: []string{"amd64", "x86_64"}, Libc: libc}
+		got, err := NewFilter(&FilterOpts{}).FilterAssets("tool", as)
+		if err != nil {
+			t.Fatalf("%s: %v", libc, err)
+		}
+		if got.Name != want {
+			t.Errorf("%s: got %s, want %s", libc, got.Name, want)
+		}
+	}
+
+	// a generic build wins over a build for another libc
+	resolver = &mockOSResolver{OS: []string{"linux"}, Arch: []string{"amd64", "x86_64"}, Libc: config.LibcGlibc}
+	got, err := NewFilter(&FilterOpts{}).FilterAssets("tool", []*Asset{{Name: "tool-linux-amd64"}, {Name: "tool-linux-amd64-musl"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "tool-linux-amd64" {
+		t.Errorf("got %s, want tool-linux-amd64", got.Name)
+	}
+}
+
+func TestFilterAssetsArchVariants(t *testing.T) {
+	cases := []struct {
+		name     string
+		resolver platformResolver
+		as       []string
+		want     string
+	}{
+		{
+			"armv7 host prefers armv7",
+			&mockOSResolver{OS: []string{"linux"}, Arch: []string{"arm"}, ArchVariants: config.ArchVariants("arm", 7)},
+			[]string{"tool-linux-arm64.tar.gz", "tool-linux-armv6.tar.gz", "tool-linux-armv7.tar.gz", "tool-linux-arm.tar.gz"},
+			"tool-linux-armv7.tar.gz",
+		},
+		{
+			"armv6 host can't run armv7",
+			&mockOSResolver{OS: []string{"linux"}, Arch: []string{"arm"}, ArchVariants: config.ArchVariants("arm", 6)},
+			[]string{"tool-linux-armhf.tar.gz", "tool-linux-armv7.tar.gz", "tool-linux-armv6.tar.gz"},
+			"tool-linux-armv6.tar.gz",
+		},
+		{
+			"arm host ignores aarch64",
+			&mockOSResolver{OS: []string{"linux"}, Arch: []string{"arm"}, ArchVariants: config.ArchVariants("arm", 7)},
+			[]string{"tool-aarch64-linux.tar.gz", "tool-armhf-linux.tar.gz"},
+			"tool-armhf-linux.tar.gz",
+		},
+		{
+			"arm64 aliases",
+			&mockOSResolver{OS: []string{"linux"}, Arch: []string{"arm64", "aarch64"}, ArchVariants: config.ArchVariants("arm64", 0)},
+			[]string{"tool-aarch64-unknown-linux.tar.gz", "tool-x86_64-unknown-linux.tar.gz"},
+			"tool-aarch64-unknown-linux.tar.gz",
+		},
+		{
+			"arm64 host prefers plain arm64 to arm64e",
+			&mockOSResolver{OS: []string{"darwin"}, Arch: []string{"arm64", "aarch64"}, ArchVariants: config.ArchVariants("arm64", 0)},
+			[]string{"tool_darwin_arm64e.tar.gz", "tool_darwin_arm64.tar.gz"},
+			"tool_darwin_arm64.tar.gz",
+		},
+		{
+			"x86-64-v3 host prefers v3",
+			&mockOSResolver{OS: []string{"linux"}, Arch: []string{"amd64", "x86_64"}, ArchVariants: config.ArchVariants("amd64", 3)},
+			[]string{"tool-linux-amd64.tar.gz", "tool-linux-amd64v3.tar.gz", "tool-linux-amd64v4.tar.gz"},
+			"tool-linux-amd64v3.tar.gz",
+		},
+		{
+			"x86-64-v2 host falls back to the baseline",
+			&mockOSResolver{OS: []string{"linux"}, Arch: []string{"amd64", "x86_64"}, ArchVariants: config.ArchVariants("amd64", 2)},
+			[]string{"tool-linux-x86_64.tar.gz", "tool-linux-x86_64_v3.tar.gz"},
+			"tool-linux-x86_64.tar.gz",
+		},
+		{
+			"linux/armv6 target",
+			mustParseTarget("linux", "armv6", ""),
+			[]string{"tool-darwin-arm64.tar.gz", "tool-linux-amd64.tar.gz", "tool-linux-armv7.tar.gz", "tool-linux-armv6.tar.gz"},
+			"tool-linux-armv6.tar.gz",
+		},
+		{
+			"windows target",
+			mustParseTarget("windows", "x86_64", ""),
+			[]string{"tool-linux-amd64.tar.gz", "tool-windows-amd64.zip", "tool-darwin-amd64.tar.gz"},
+			"tool-windows-amd64.zip",
+		},
+		{
+			"386 host ignores x86_64",
+			&mockOSResolver{OS: []string{"linux"}, Arch: []string{"386", "i686", "x86"}, ArchVariants: config.ArchVariants("386", 0)},
+			[]string{"tool-linux-x86_64.tar.gz", "tool-linux-x86.tar.gz"},
+			"tool-linux-x86.tar.gz",
+		},
+	}
+
+	for _, c := range cases {
+		resolver = c.resolver
+		as := make([]*Asset, len(c.as))
+		for i, name := range c.as {
+			as[i] = &Asset{Name: name}
+		}
+		got, err := NewFilter(&FilterOpts{}).FilterAssets("tool", as)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got.Name != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got.Name, c.want)
+		}
+	}
+}
+
+func TestScoreAssetOverlappingArchs(t *testing.T) {
+	resolver = &mockOSResolver{OS: []string{"darwin"}, Arch: []string{"arm64", "arm64e"}}
+	scores := map[string]int{"darwin": 10, "arm64": 5, "arm64e": 5}
+	keys := []string{"darwin", "arm64", "arm64e"}
+	if got := scoreAsset("tool_darwin_arm64e.tar.gz", scores, keys); got != 15 {
+		t.Errorf("expected the arch to be scored once, got %d", got)
+	}
+}
+
+func TestFilterAssetsNonInteractive(t *testing.T) {
+	options.SetInteractive(false)
+	defer options.SetInteractive(true)
+
+	resolver = testLinuxAMDResolver
+	as := []*Asset{
+		{Name: "tool-linux-amd64-gnu.tar.gz"},
+		{Name: "tool-linux-amd64-static.tar.gz"},
+		{Name: "tool-windows-amd64.zip"},
+	}
+	_, err := NewFilter(&FilterOpts{}).FilterAssets("tool", as)
+	var ae *options.AmbiguousError
+	if !errors.As(err, &ae) {
+		t.Fatalf("expected an ambiguous selection error, got %v", err)
+	}
+	if want := []string{"tool-linux-amd64-gnu.tar.gz", "tool-linux-amd64-static.tar.gz"}; !reflect.DeepEqual(ae.Candidates, want) {
+		t.Errorf("got candidates %v, want %v", ae.Candidates, want)
+	}
+
+	// the name pattern resolves it
+	got, err := NewFilter(&FilterOpts{NamePattern: "*-static*"}).FilterAssets("tool", as)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "tool-linux-amd64-static.tar.gz" {
+		t.Errorf("got %s", got.Name)
+	}
+}
+
+func TestFilterAssetsScoringRules(t *testing.T) {
+	resolver = testLinuxAMDResolver
+	as := []*Asset{
+		{Name: "tool-x86_64-unknown-linux-gnu.tar.gz"},
+		{Name: "tool-x86_64-unknown-linux-musl.tar.gz"},
+		{Name: "tool-x86_64-unknown-linux-gnu-lite.tar.gz"},
+	}
+
+	cfg := config.Get()
+	defer func() { cfg.ScoringRules = nil }()
+
+	cases := []struct {
+		global  []*config.ScoringRule
+		binary  []*config.ScoringRule
+		want    string
+		wantErr bool
+	}{
+		{
+			global: []*config.ScoringRule{{Match: "musl", Score: 20}},
+			want:   "tool-x86_64-unknown-linux-musl.tar.gz",
+		},
+		{
+			global: []*config.ScoringRule{{Match: "musl", Score: 20}},
+			binary: []*config.ScoringRule{{Match: "musl", Exclude: true}, {Match: `-lite\.`, Regex: true, Score: -30}},
+			want:   "tool-x86_64-unknown-linux-gnu.tar.gz",
+		},
+		{
+			global:  []*config.ScoringRule{{Match: "linux", Exclude: true}},
+			wantErr: true,
+		},
+		{
+			global:  []*config.ScoringRule{{Match: "(", Regex: true, Score: 1}},
+			wantErr: true,
+		},
+	}
+
+	for i, c := range cases {
+		cfg.ScoringRules = c.global
+		f := NewFilter(&FilterOpts{ScoringRules: c.binary})
+		got, err := f.FilterAssets("tool", as)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("case %d: expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if got.Name != c.want {
+			t.Errorf("case %d: got %s, want %s", i, got.Name, c.want)
+		}
+	}
+
+	// rules don't bring back assets for other platforms
+	cfg.ScoringRules = []*config.ScoringRule{{Match: "static", Score: 20}}
+	got, err := NewFilter(&FilterOpts{}).FilterAssets("tool", []*Asset{
+		{Name: "tool-linux-amd64.tar.gz"},
+		{Name: "tool-windows-static.zip"},
+	})
+	if err != nil || got.Name != "tool-linux-amd64.tar.gz" {
+		t.Errorf("expected the linux asset, got %v (%v)", got, err)
+	}
+
+	// excludes only apply to release assets, not to archive files
+	cfg.ScoringRules = []*config.ScoringRule{{Match: "-lite", Exclude: true}}
+	out, err := NewFilter(&FilterOpts{}).ProcessReader("tool.tar", bytes.NewReader(makeTar(map[string]string{"tool-lite/bin/tool-lite": "lite binary"})))
+	if err != nil || out.Name != "tool-lite" {
+		t.Errorf("expected the archive file to be kept, got %v (%v)", out, err)
+	}
+}
+
 // makeTar builds an in-memory tar archive where every entry has mode 0755.
 func makeTar(files map[string]string) []byte {
 	var buf bytes.Buffer
@@ -231,10 +506,357 @@ func makeZip(files map[string]string) []byte {
 	return buf.Bytes()
 }
 
+func bytesOpener(data []byte) opener {
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+}
+
+func TestProcessReaderTarGz(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, _ = gw.Write(makeTar(map[string]string{
+		"tool-v1.0/README.md": "docs",
+		"tool-v1.0/mytool":    "mytool binary",
+	}))
+	_ = gw.Close()
+
+	f := NewFilter(&FilterOpts{PackagePath: "tool-v1.0/mytool"})
+	out, err := f.ProcessReader("tool.tar.gz", bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(out.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "mytool binary" {
+		t.Errorf("unexpected contents %q", data)
+	}
+	if out.Name != "mytool" || out.PackagePath != "tool-v1.0/mytool" {
+		t.Errorf("unexpected name %q and package path %q", out.Name, out.PackagePath)
+	}
+	if len(f.tempFiles) > 0 {
+		t.Errorf("temp files %v weren't removed", f.tempFiles)
+	}
+
+	// the file part of the name pattern selects files that were moved
+	f = NewFilter(&FilterOpts{PackagePath: "tool-v0.9/mytool", NamePattern: "*/mytool"})
+	out, err = f.ProcessReader("tool.tar.gz", bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.PackagePath != "tool-v1.0/mytool" {
+		t.Errorf("unexpected package path %q", out.PackagePath)
+	}
+}
+
+func TestProcessReaderZstdLz4(t *testing.T) {
+	data := makeTar(map[string]string{"tool-v1.0/mytool": "mytool binary"})
+
+	var zbuf bytes.Buffer
+	zw, _ := zstd.NewWriter(&zbuf)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+
+	var lbuf bytes.Buffer
+	lw := lz4.NewWriter(&lbuf)
+	_, _ = lw.Write(data)
+	_ = lw.Close()
+
+	for name, archive := range map[string][]byte{"tool.tar.zst": zbuf.Bytes(), "tool.tar.lz4": lbuf.Bytes()} {
+		f := NewFilter(&FilterOpts{})
+		out, err := f.ProcessReader(name, bytes.NewReader(archive))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := io.ReadAll(out.Source)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(got) != "mytool binary" || out.Name != "mytool" {
+			t.Errorf("%s: unexpected file %q with contents %q", name, out.Name, got)
+		}
+	}
+}
+
+func TestProcessReader7z(t *testing.T) {
+	archive := make7z(map[string]string{
+		"tool-v1.0/README.md": "readme",
+		"tool-v1.0/mytool":    "mytool binary",
+	}, "tool-v1.0/mytool")
+
+	f := NewFilter(&FilterOpts{})
+	out, err := f.ProcessReader("tool.7z", bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(out.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "mytool binary" || out.Name != "mytool" || out.PackagePath != "tool-v1.0/mytool" {
+		t.Errorf("unexpected file %q (%s) with contents %q", out.Name, out.PackagePath, got)
+	}
+
+	// the file recorded on install is extracted without listing choices
+	f = NewFilter(&FilterOpts{PackagePath: "tool-v1.0/README.md"})
+	out, err = f.ProcessReader("tool.7z", bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(out.Source); string(got) != "readme" {
+		t.Errorf("unexpected contents %q", got)
+	}
+}
+
+// make7z builds a 7z archive storing files uncompressed in a single
+// folder, the executables are marked with unix permissions
+func make7z(files map[string]string, executables ...string) []byte {
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	number := func(b *bytes.Buffer, n int) {
+		if n < 0x80 {
+			b.WriteByte(byte(n))
+			return
+		}
+		b.Write([]byte{0x80 | byte(n>>8), byte(n)})
+	}
+
+	var packed bytes.Buffer
+	for _, n := range names {
+		packed.WriteString(files[n])
+	}
+
+	var h bytes.Buffer
+	// header, main streams info and one packed stream
+	h.Write([]byte{0x01, 0x04, 0x06, 0x00, 0x01, 0x09})
+	number(&h, packed.Len())
+	// one folder with the copy coder
+	h.Write([]byte{0x00, 0x07, 0x0b, 0x01, 0x00, 0x01, 0x01, 0x00, 0x0c})
+	number(&h, packed.Len())
+	// the files of the folder, their sizes but the last one and CRCs
+	h.Write([]byte{0x00, 0x08, 0x0d})
+	number(&h, len(names))
+	if len(names) > 1 {
+		h.WriteByte(0x09)
+		for _, n := range names[:len(names)-1] {
+			number(&h, len(files[n]))
+		}
+	}
+	h.Write([]byte{0x0a, 0x01})
+	for _, n := range names {
+		_ = binary.Write(&h, binary.LittleEndian, crc32.ChecksumIEEE([]byte(files[n])))
+	}
+	h.Write([]byte{0x00, 0x00})
+
+	// files info with the UTF-16 names and the attributes
+	h.WriteByte(0x05)
+	number(&h, len(names))
+	var nameData bytes.Buffer
+	nameData.WriteByte(0)
+	for _, n := range names {
+		for _, r := range n + "\x00" {
+			_ = binary.Write(&nameData, binary.LittleEndian, uint16(r))
+		}
+	}
+	h.WriteByte(0x11)
+	number(&h, nameData.Len())
+	h.Write(nameData.Bytes())
+	h.WriteByte(0x15)
+	number(&h, 2+4*len(names))
+	h.Write([]byte{0x01, 0x00})
+	for _, n := range names {
+		mode := uint32(0o100644)
+		for _, e := range executables {
+			if e == n {
+				mode = 0o100755
+			}
+		}
+		_ = binary.Write(&h, binary.LittleEndian, 0x8000|mode<<16)
+	}
+	h.Write([]byte{0x00, 0x00})
+
+	start := make([]byte, 20)
+	binary.LittleEndian.PutUint64(start, uint64(packed.Len()))
+	binary.LittleEndian.PutUint64(start[8:], uint64(h.Len()))
+	binary.LittleEndian.PutUint32(start[16:], crc32.ChecksumIEEE(h.Bytes()))
+
+	var buf bytes.Buffer
+	buf.Write([]byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c, 0x00, 0x04})
+	_ = binary.Write(&buf, binary.LittleEndian, crc32.ChecksumIEEE(start))
+	buf.Write(start)
+	buf.Write(packed.Bytes())
+	buf.Write(h.Bytes())
+	return buf.Bytes()
+}
+
+// makeDeb builds a deb package with a gzipped data.tar member
+func makeDeb(files map[string]string) []byte {
+	var data bytes.Buffer
+	gw := gzip.NewWriter(&data)
+	_, _ = gw.Write(makeTar(files))
+	_ = gw.Close()
+
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	for _, m := range []struct {
+		name string
+		data []byte
+	}{{"debian-binary", []byte("2.0\n")}, {"control.tar.gz", []byte("x")}, {"data.tar.gz", data.Bytes()}} {
+		fmt.Fprintf(&buf, "%-16s%-12s%-6s%-6s%-8s%-10d`\n", m.name, "0", "0", "0", "100644", len(m.data))
+		buf.Write(m.data)
+		if len(m.data)%2 != 0 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// makeRpm builds an rpm package with empty headers and a gzipped cpio payload
+func makeRpm(files map[string]string) []byte {
+	var payload bytes.Buffer
+	writeEntry := func(name string, mode int, data string) {
+		fmt.Fprintf(&payload, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X", 0, mode, 0, 0, 1, 0, len(data), 0, 0, 0, 0, len(name)+1, 0)
+		payload.WriteString(name + "\x00")
+		for payload.Len()%4 != 0 {
+			payload.WriteByte(0)
+		}
+		payload.WriteString(data)
+		for payload.Len()%4 != 0 {
+			payload.WriteByte(0)
+		}
+	}
+	for name, content := range files {
+		writeEntry(name, 0o100755, content)
+	}
+	writeEntry("TRAILER!!!", 0, "")
+
+	var buf bytes.Buffer
+	buf.Write(append([]byte{0xed, 0xab, 0xee, 0xdb}, make([]byte, 92)...))
+	for i := 0; i < 2; i++ {
+		buf.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	}
+	gw := gzip.NewWriter(&buf)
+	_, _ = gw.Write(payload.Bytes())
+	_ = gw.Close()
+	return buf.Bytes()
+}
+
+func TestProcessReaderPackages(t *testing.T) {
+	files := map[string]string{"./usr/bin/mytool": "mytool binary"}
+	for name, pkg := range map[string][]byte{"tool.deb": makeDeb(files), "tool.rpm": makeRpm(files)} {
+		f := NewFilter(&FilterOpts{})
+		out, err := f.ProcessReader(name, bytes.NewReader(pkg))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := io.ReadAll(out.Source)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(got) != "mytool binary" || out.Name != "mytool" || out.PackagePath != "./usr/bin/mytool" {
+			t.Errorf("%s: unexpected file %q (%s) with contents %q", name, out.Name, out.PackagePath, got)
+		}
+	}
+}
+
+func TestProcessReaderGroup(t *testing.T) {
+	data := makeTar(map[string]string{
+		"tool-v1.0/bin/tool":  "tool binary",
+		"tool-v1.0/bin/tool2": "tool2 binary",
+		"tool-v1.0/LICENSE":   "license",
+	})
+
+	f := NewFilter(&FilterOpts{Files: []string{"tool-v1.0/bin/*", "LICENSE"}})
+	out, err := f.ProcessReader("tool.tar", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, m := range out.Group {
+		data, err := io.ReadAll(m.Source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[m.PackagePath] = string(data)
+	}
+	want := map[string]string{
+		"tool-v1.0/bin/tool":  "tool binary",
+		"tool-v1.0/bin/tool2": "tool2 binary",
+		"tool-v1.0/LICENSE":   "license",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got group %v, want %v", got, want)
+	}
+	if len(f.tempFiles) > 0 {
+		t.Errorf("temp files %v weren't removed", f.tempFiles)
+	}
+
+	f = NewFilter(&FilterOpts{Files: []string{"missing"}})
+	if _, err := f.ProcessReader("tool.tar", bytes.NewReader(data)); err == nil {
+		t.Error("expected an error for a pattern without matches")
+	}
+}
+
+func TestExtraKind(t *testing.T) {
+	cases := map[string]string{
+		"rg-14.0.0/complete/rg.bash":          ExtraBash,
+		"rg-14.0.0/complete/_rg":              ExtraZsh,
+		"rg-14.0.0/complete/rg.fish":          ExtraFish,
+		"rg-14.0.0/doc/rg.1":                  "man1",
+		"fd-v9.0.0/fd.1":                      "man1",
+		"gh_2.40.0/share/man/man1/gh-pr.1.gz": "man1",
+		"tool/completions/bash/tool":          ExtraBash,
+		"tool/completions/tool.zsh":           ExtraZsh,
+		"tool-1.2.1":                          "",
+		"tool/README.md":                      "",
+		"tool/_internal.go":                   "",
+	}
+	for name, want := range cases {
+		if got := extraKind(name); got != want {
+			t.Errorf("%s: got kind %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestProcessReaderExtras(t *testing.T) {
+	data := makeTar(map[string]string{
+		"rg/rg":               "rg binary",
+		"rg/complete/rg.bash": "bash completion",
+	})
+
+	f := NewFilter(&FilterOpts{PackagePath: "rg/rg", Extras: true})
+	out, err := f.ProcessReader("rg.tar", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(out.Source); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Extras) != 1 || out.Extras[0].Kind != ExtraBash {
+		t.Fatalf("unexpected extras %v", out.Extras)
+	}
+	got, err := io.ReadAll(out.Extras[0].Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "bash completion" {
+		t.Errorf("unexpected completion contents %q", got)
+	}
+	if len(f.tempFiles) > 0 {
+		t.Errorf("temp files %v weren't removed", f.tempFiles)
+	}
+}
+
 func TestProcessTarNamePattern(t *testing.T) {
 	data := makeTar(map[string]string{
-		"tool-v1.0/mytool":  "mytool binary",
-		"tool-v1.0/helper":  "helper binary",
+		"tool-v1.0/mytool": "mytool binary",
+		"tool-v1.0/helper": "helper binary",
 	})
 
 	cases := []struct {
@@ -250,7 +872,7 @@ func TestProcessTarNamePattern(t *testing.T) {
 	for _, c := range cases {
 		f := NewFilter(&FilterOpts{NamePattern: c.pattern})
 		f.namePatternUsed = true // simulate top-level asset already selected
-		result, err := f.processTar("repo", bytes.NewReader(data))
+		result, _, err := f.processTar("repo", bytesOpener(data))
 		if c.wantErr {
 			if err == nil {
 				t.Errorf("pattern %q: expected error, got nil", c.pattern)
@@ -286,7 +908,7 @@ func TestProcessZipNamePattern(t *testing.T) {
 	for _, c := range cases {
 		f := NewFilter(&FilterOpts{NamePattern: c.pattern})
 		f.namePatternUsed = true // simulate top-level asset already selected
-		result, err := f.processZip("repo", bytes.NewReader(data))
+		result, _, err := f.processZip("repo", bytesOpener(data))
 		if c.wantErr {
 			if err == nil {
 				t.Errorf("pattern %q: expected error, got nil", c.pattern)
@@ -316,6 +938,18 @@ func TestIsSupportedExt(t *testing.T) {
 			"Ultimaker_Cura-4.7.1-win64.msi",
 			false,
 		},
+		{
+			"tool-1.0.0-linux-amd64.tar.zst",
+			true,
+		},
+		{
+			"tool-1.0.0-linux-amd64.lz4",
+			true,
+		},
+		{
+			"tool-1.0.0-windows-amd64.7z",
+			true,
+		},
 	}
 
 	for _, c := range cases {
@@ -326,3 +960,90 @@ func TestIsSupportedExt(t *testing.T) {
 	}
 
 }
+
+func TestProcessURLRewrite(t *testing.T) {
+	var requested string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		_, _ = w.Write([]byte("binary contents"))
+	}))
+	defer ts.Close()
+
+	t.Setenv("BIN_CACHE_DIR", t.TempDir())
+	cfg := config.Get()
+	cfg.URLRewrites = map[string]string{
+		"https://github.com/":            "https://unused.example.com/",
+		"https://github.com/marcosnils/": ts.URL + "/mirror/",
+	}
+	defer func() { cfg.URLRewrites = nil }()
+
+	f := NewFilter(&FilterOpts{})
+	out, err := f.ProcessURL(&FilteredAsset{Name: "bin", URL: "https://github.com/marcosnils/bin/releases/download/v0.1.0/bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(out.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requested != "/mirror/bin/releases/download/v0.1.0/bin" {
+		t.Errorf("unexpected request path %s", requested)
+	}
+	if string(data) != "binary contents" {
+		t.Errorf("unexpected contents %q", data)
+	}
+}
+
+func TestProcessURLCache(t *testing.T) {
+	t.Setenv("BIN_CACHE_DIR", t.TempDir())
+	requests, content, etag := 0, "binary contents", `"v1"`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer ts.Close()
+
+	fetch := func(size int64, digest, want string) string {
+		t.Helper()
+		out, err := NewFilter(&FilterOpts{}).ProcessURL(&FilteredAsset{Name: "bin", URL: ts.URL + "/bin", Size: size, Digest: digest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(out.Source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("expected %q, got %q", want, data)
+		}
+		return out.Digest
+	}
+
+	digest := fetch(15, "", content)
+	// the cached download is revalidated with its ETag
+	if fetch(15, "", content) != digest || requests != 2 {
+		t.Errorf("expected the cached download after 2 requests, got %d", requests)
+	}
+	// or reused without requests if the provider reports its digest
+	if fetch(15, digest, content) != digest || requests != 2 {
+		t.Errorf("expected the cached download without requests, got %d", requests)
+	}
+
+	// the content changed keeping the same size
+	content, etag = "binary CONTENTS", `"v2"`
+	if fetch(15, "", content) == digest || requests != 3 {
+		t.Errorf("expected a new download, got %d requests", requests)
+	}
+	if fetch(15, digest, content) == digest || requests != 4 {
+		t.Errorf("expected a download for another digest, got %d requests", requests)
+	}
+	// downloads with an unknown size aren't reused
+	if fetch(0, "", content); requests != 5 {
+		t.Errorf("expected 5 requests, got %d", requests)
+	}
+}
@@ -0,0 +1,313 @@
+package assets
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/cheggaaa/pb"
+	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/httpclient"
+)
+
+const (
+	defaultRetries   = 3
+	defaultRetryWait = time.Second
+	defaultTimeout   = time.Minute
+	// maxRetryWait caps the backoff and the Retry-After
+	// waits servers ask for
+	maxRetryWait = time.Minute
+)
+
+var sleep = time.Sleep
+
+// progress shows a progress bar for each download,
+// see SetProgress
+var progress = true
+
+// SetProgress enables or disables the progress bars of
+// the downloads, which get mixed up when several binaries
+// are downloaded at once
+func SetProgress(enabled bool) {
+	progress = enabled
+}
+
+// errStalled is returned when a download doesn't
+// receive any data for the configured timeout
+var errStalled = errors.New("no data received")
+
+// errBadRange is returned when a download
+// can't be resumed from the last byte
+var errBadRange = errors.New("the download couldn't be resumed")
+
+// errNotModified is returned when the server answers a
+// conditional request with a 304, see ProcessURL
+var errNotModified = errors.New("not modified")
+
+// statusError is a response that isn't successful
+type statusError struct {
+	code       int
+	url        *url.URL
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%d response when checking binary from %s", e.code, e.url)
+}
+
+// downloadSettings returns the retries, the first retry
+// wait and the timeout of the config or their defaults
+func downloadSettings() (int, time.Duration, time.Duration) {
+	retries, wait, timeout := defaultRetries, defaultRetryWait, defaultTimeout
+	settings := config.Get().Download
+	if settings == nil {
+		return retries, wait, timeout
+	}
+	if settings.Retries != 0 {
+		retries = max(settings.Retries, 0)
+	}
+	if settings.RetryWait != "" {
+		if d, err := time.ParseDuration(settings.RetryWait); err == nil {
+			wait = d
+		} else {
+			log.Warnf("Ignoring the download retry_wait: %v", err)
+		}
+	}
+	if settings.Timeout != "" {
+		if d, err := time.ParseDuration(settings.Timeout); err == nil && d > 0 {
+			timeout = d
+		} else {
+			log.Warnf("Ignoring the download timeout %q", settings.Timeout)
+		}
+	}
+	return retries, wait, timeout
+}
+
+// downloader spools a response into a file, resuming
+// from the last byte written when possible
+type downloader struct {
+	req     *http.Request
+	file    *os.File
+	timeout time.Duration
+	bar     *pb.ProgressBar
+
+	written int64
+	// validator is the ETag or Last-Modified of the
+	// first response, used to resume the same content
+	validator string
+	resumable bool
+	// etag is the ETag of the last response
+	etag string
+}
+
+// download spools the response to req into a temp file and returns
+// its path, sha256 and ETag. Network errors, stalls and 5xx responses
+// are retried with an exponential backoff, resuming the partial
+// download with a Range request if the server supports it.
+func download(req *http.Request) (string, string, string, error) {
+	retries, wait, timeout := downloadSettings()
+
+	tmp, err := os.CreateTemp("", "bin-download-*")
+	if err != nil {
+		return "", "", "", err
+	}
+	d := &downloader{req: req, file: tmp, timeout: timeout}
+	defer func() {
+		if d.bar != nil {
+			d.bar.Finish()
+		}
+	}()
+
+	for attempt := 0; ; attempt++ {
+		err = d.fetch()
+		if err == nil || !isTransient(err) || attempt >= retries {
+			break
+		}
+		delay := min(wait<<attempt, maxRetryWait)
+		var se *statusError
+		if errors.As(err, &se) && se.retryAfter > 0 {
+			delay = min(se.retryAfter, maxRetryWait)
+		}
+		log.Warnf("Download of %s failed: %v. Retrying in %s (%d/%d)", req.URL, err, delay, attempt+1, retries)
+		sleep(delay)
+	}
+
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	h := sha256.New()
+	if err == nil {
+		_, err = io.Copy(h, tmp)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", "", "", err
+	}
+	return tmp.Name(), fmt.Sprintf("%x", h.Sum(nil)), d.etag, nil
+}
+
+// fetch makes a request for the rest of the download and writes it
+func (d *downloader) fetch() error {
+	ctx, cancel := context.WithCancel(d.req.Context())
+	defer cancel()
+	req := d.req.Clone(ctx)
+	resuming := d.written > 0 && d.resumable
+	if resuming {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", d.written))
+		if d.validator != "" {
+			req.Header.Set("If-Range", d.validator)
+		}
+	}
+
+	// the timer covers the wait for the response and for each
+	// read of the body, the request is cancelled when it fires
+	var stalled atomic.Bool
+	timer := time.AfterFunc(d.timeout, func() {
+		stalled.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+
+	log.Debugf("Checking binary from %s", req.URL)
+	res, err := httpclient.Client.Do(req)
+	if err != nil {
+		if stalled.Load() {
+			return errStalled
+		}
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match") != "":
+		return errNotModified
+	case resuming && res.StatusCode == http.StatusPartialContent && rangeStart(res) == d.written:
+		log.Debugf("Resuming the download of %s from byte %d", req.URL, d.written)
+	case resuming && (res.StatusCode == http.StatusPartialContent || res.StatusCode == http.StatusRequestedRangeNotSatisfiable):
+		// the server can't resume from the last byte, start over
+		d.resumable = false
+		return errBadRange
+	case res.StatusCode >= 200 && res.StatusCode <= 299 && res.StatusCode != http.StatusPartialContent:
+		if d.written > 0 {
+			log.Debugf("Restarting the download of %s", req.URL)
+			if err := d.file.Truncate(0); err != nil {
+				return err
+			}
+			if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			d.written = 0
+		}
+		d.resumable = res.Header.Get("Accept-Ranges") == "bytes"
+		d.etag = res.Header.Get("ETag")
+		d.validator = d.etag
+		if d.validator == "" || strings.HasPrefix(d.validator, "W/") {
+			// weak ETags can't be used with If-Range
+			d.validator = res.Header.Get("Last-Modified")
+		}
+		if d.bar == nil {
+			log.Infof("Starting download of %s", req.URL)
+			d.bar = pb.Full.New(0).SetTotal(res.ContentLength)
+			if progress {
+				d.bar.Start()
+			}
+		} else {
+			d.bar.SetTotal(res.ContentLength)
+			d.bar.SetCurrent(0)
+		}
+	default:
+		_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<10))
+		return &statusError{code: res.StatusCode, url: req.URL, retryAfter: retryAfter(res)}
+	}
+
+	body := &idleReader{r: res.Body, timer: timer, timeout: d.timeout}
+	n, err := io.Copy(d.file, d.bar.NewProxyReader(body))
+	d.written += n
+	if err != nil && stalled.Load() {
+		return errStalled
+	}
+	return err
+}
+
+// idleReader resets timer on every read
+type idleReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// rangeStart returns the first byte of the Content-Range
+// of res, or -1 if it doesn't have a valid one
+func rangeStart(res *http.Response) int64 {
+	cr, ok := strings.CutPrefix(res.Header.Get("Content-Range"), "bytes ")
+	if !ok {
+		return -1
+	}
+	start, _, ok := strings.Cut(cr, "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// retryAfter returns the wait a 429 or 503 response asks for
+func retryAfter(res *http.Response) time.Duration {
+	ra := res.Header.Get("Retry-After")
+	if ra == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(ra); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(ra); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// isTransient checks if a failed download might work if it's retried
+func isTransient(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500 || se.code == http.StatusTooManyRequests || se.code == http.StatusRequestTimeout
+	}
+	if errors.Is(err, errStalled) || errors.Is(err, errBadRange) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	// every url.Error is a net.Error, only the
+	// network errors it wraps are transient
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		err = ue.Err
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
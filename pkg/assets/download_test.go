@@ -0,0 +1,207 @@
+package assets
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marcosnils/bin/pkg/config"
+)
+
+// dropWriter aborts the response after writing limit bytes,
+// closing the connection like a flaky network would
+type dropWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *dropWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n, _ := w.ResponseWriter.Write(p[:w.limit])
+		w.ResponseWriter.(http.Flusher).Flush()
+		w.limit -= n
+		panic(http.ErrAbortHandler)
+	}
+	w.limit -= len(p)
+	return w.ResponseWriter.Write(p)
+}
+
+// flakyServer serves content, dropping the first drops requests after
+// a quarter of it. Ranges are supported if ranges is set.
+func flakyServer(t *testing.T, content []byte, drops int, ranges bool) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Header.Get("Range"))
+		n := len(requests)
+		mu.Unlock()
+
+		if n <= drops {
+			w = &dropWriter{ResponseWriter: w, limit: len(content) / 4}
+		}
+		if ranges {
+			w.Header().Set("ETag", `"v1"`)
+			http.ServeContent(w, r, "asset", time.Time{}, bytes.NewReader(content))
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &requests
+}
+
+func useDownloadSettings(t *testing.T, settings *config.Download) *[]time.Duration {
+	cfg := config.Get()
+	old, oldSleep := cfg.Download, sleep
+	t.Cleanup(func() { cfg.Download, sleep = old, oldSleep })
+	cfg.Download = settings
+
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	return &waits
+}
+
+func checkDownload(t *testing.T, u string, want []byte) error {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, digest, _, err := download(req)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("downloaded %d bytes that don't match the %d expected", len(got), len(want))
+	}
+	if digest != fmt.Sprintf("%x", sha256.Sum256(want)) {
+		t.Errorf("unexpected digest %s", digest)
+	}
+	return nil
+}
+
+func TestDownloadResume(t *testing.T) {
+	content := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	t.Run("resumes with ranges", func(t *testing.T) {
+		waits := useDownloadSettings(t, nil)
+		ts, requests := flakyServer(t, content, 2, true)
+		if err := checkDownload(t, ts.URL, content); err != nil {
+			t.Fatal(err)
+		}
+		if len(*requests) != 3 || (*requests)[0] != "" || !strings.HasPrefix((*requests)[1], "bytes=") {
+			t.Errorf("unexpected requests %q", *requests)
+		}
+		if fmt.Sprint(*waits) != "[1s 2s]" {
+			t.Errorf("unexpected backoff %v", *waits)
+		}
+	})
+
+	t.Run("restarts without ranges", func(t *testing.T) {
+		useDownloadSettings(t, nil)
+		ts, requests := flakyServer(t, content, 1, false)
+		if err := checkDownload(t, ts.URL, content); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%q", *requests) != `["" ""]` {
+			t.Errorf("unexpected requests %q", *requests)
+		}
+	})
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		useDownloadSettings(t, &config.Download{Retries: 2, RetryWait: "10ms"})
+		ts, requests := flakyServer(t, content, 5, true)
+		if err := checkDownload(t, ts.URL, content); err == nil {
+			t.Fatal("expected an error")
+		}
+		if len(*requests) != 3 {
+			t.Errorf("expected 3 requests, got %d", len(*requests))
+		}
+	})
+
+	t.Run("retries stalled downloads", func(t *testing.T) {
+		useDownloadSettings(t, &config.Download{Timeout: "100ms"})
+		first := true
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if first {
+				first = false
+				w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+				_, _ = w.Write(content[:1000])
+				w.(http.Flusher).Flush()
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+				return
+			}
+			http.ServeContent(w, r, "asset", time.Time{}, bytes.NewReader(content))
+		}))
+		defer ts.Close()
+		if err := checkDownload(t, ts.URL, content); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestDownloadStatus(t *testing.T) {
+	cases := []struct {
+		name     string
+		statuses []int
+		wantErr  bool
+		requests int
+		waits    string
+	}{
+		{"5xx are retried", []int{502, 503, 200}, false, 3, "[1s 2s]"},
+		{"429 waits for Retry-After", []int{429, 200}, false, 2, "[7s]"},
+		{"4xx fail", []int{404}, true, 1, "[]"},
+		{"retries are limited", []int{500, 500, 500, 500, 500}, true, 4, "[1s 2s 4s]"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			waits := useDownloadSettings(t, nil)
+			requests := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := c.statuses[requests]
+				requests++
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "7")
+				}
+				w.WriteHeader(status)
+				fmt.Fprint(w, "contents")
+			}))
+			defer ts.Close()
+
+			err := checkDownload(t, ts.URL, []byte("contents"))
+			if (err != nil) != c.wantErr {
+				t.Errorf("unexpected error %v", err)
+			}
+			if requests != c.requests {
+				t.Errorf("expected %d requests, got %d", c.requests, requests)
+			}
+			if fmt.Sprint(*waits) != c.waits {
+				t.Errorf("expected the waits %s, got %v", c.waits, *waits)
+			}
+		})
+	}
+
+	useDownloadSettings(t, &config.Download{Retries: -1})
+	if err := checkDownload(t, "http://127.0.0.1:1/asset", nil); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,70 @@
+package assets
+
+import (
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/caarlos0/log"
+)
+
+// Kinds of extra files shipped along with binaries in archives
+const (
+	ExtraBash = "bash"
+	ExtraZsh  = "zsh"
+	ExtraFish = "fish"
+	// man pages kinds are "man" followed by the section (e.g. man1)
+	ExtraMan = "man"
+)
+
+// ExtraFile is a shell completion or man page
+// found in the archive of a binary
+type ExtraFile struct {
+	Source      io.Reader
+	Kind        string
+	Name        string
+	PackagePath string
+}
+
+// manPageRegex matches man pages like rg.1 or fd.1.gz, but not
+// versioned names like tool-1.2.1
+var manPageRegex = regexp.MustCompile(`^[a-z0-9_+-]*[a-z_+-]\.([1-9])(\.gz)?$`)
+
+// extraKind returns the kind of extra file of an archive entry
+// following the layout most releases use, or an empty string
+// if it's neither a completion nor a man page
+func extraKind(name string) string {
+	lower := strings.ToLower(name)
+	base, dir := path.Base(lower), path.Dir(lower)
+
+	if m := manPageRegex.FindStringSubmatch(base); m != nil {
+		return ExtraMan + m[1]
+	}
+
+	inCompletions := strings.Contains(dir, "complet")
+	switch {
+	case strings.HasSuffix(base, ".fish"):
+		return ExtraFish
+	case strings.HasSuffix(base, ".zsh"), inCompletions && strings.HasPrefix(base, "_") && !strings.Contains(base, "."):
+		return ExtraZsh
+	case strings.HasSuffix(base, ".bash"), strings.HasSuffix(base, ".bash-completion"), inCompletions && strings.Contains(dir, "bash"):
+		return ExtraBash
+	}
+	return ""
+}
+
+// archiveExtras returns the completions and man pages
+// between the entries of an archive
+func archiveExtras(entries []archiveEntry, member func(string) opener) []*ExtraFile {
+	var extras []*ExtraFile
+	for _, e := range entries {
+		kind := extraKind(e.name)
+		if kind == "" {
+			continue
+		}
+		log.Debugf("Found %s file %s", kind, e.name)
+		extras = append(extras, &ExtraFile{Source: &lazyReader{open: member(e.name)}, Kind: kind, Name: path.Base(e.name), PackagePath: e.name})
+	}
+	return extras
+}
@@ -0,0 +1,245 @@
+package assets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/h2non/filetype"
+)
+
+// cpioType is the payload of rpm packages once decompressed.
+// Only the "new ASCII" formats used by rpm are supported.
+var cpioType = filetype.AddType("cpio", "application/x-cpio")
+
+func init() {
+	filetype.AddMatcher(cpioType, func(buf []byte) bool {
+		return bytes.HasPrefix(buf, []byte("070701")) || bytes.HasPrefix(buf, []byte("070702"))
+	})
+}
+
+const (
+	arMagic         = "!<arch>\n"
+	arHeaderSize    = 60
+	rpmLeadSize     = 96
+	cpioHeaderSize  = 110
+	cpioTrailerName = "TRAILER!!!"
+)
+
+// processDeb streams the data.tar.* member of a .deb package, the
+// returned opener is processed again to decompress and list the tar
+func (f *Filter) processDeb(name string, open opener) (*finalFile, opener, error) {
+	next := func() (io.ReadCloser, error) {
+		rc, err := open()
+		if err != nil {
+			return nil, err
+		}
+		r, err := debData(bufio.NewReader(rc))
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: r, close: rc.Close}, nil
+	}
+	return &finalFile{Name: name}, next, nil
+}
+
+// debData advances r to the data.tar.* member of the ar archive
+func debData(r io.Reader) (io.Reader, error) {
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != arMagic {
+		return nil, fmt.Errorf("invalid deb package")
+	}
+	header := make([]byte, arHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("data archive not found in deb package: %w", err)
+		}
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deb package member %s: %w", name, err)
+		}
+		if strings.HasPrefix(name, "data.tar") {
+			log.Debugf("Found %s in deb package", name)
+			return io.LimitReader(r, size), nil
+		}
+		// members are padded to an even size
+		if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// processRpm skips the rpm lead and headers and streams the payload,
+// which is a compressed cpio archive
+func (f *Filter) processRpm(name string, open opener) (*finalFile, opener, error) {
+	next := func() (io.ReadCloser, error) {
+		rc, err := open()
+		if err != nil {
+			return nil, err
+		}
+		br := bufio.NewReader(rc)
+		if err := skipRpmHeaders(br); err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: br, close: rc.Close}, nil
+	}
+	return &finalFile{Name: name}, next, nil
+}
+
+func skipRpmHeaders(r io.Reader) error {
+	if _, err := io.CopyN(io.Discard, r, rpmLeadSize); err != nil {
+		return fmt.Errorf("invalid rpm package: %w", err)
+	}
+	// the signature header is padded to 8 bytes, the main header isn't
+	for _, pad := range []bool{true, false} {
+		header := make([]byte, 16)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return fmt.Errorf("invalid rpm package: %w", err)
+		}
+		if !bytes.Equal(header[:3], []byte{0x8e, 0xad, 0xe8}) {
+			return fmt.Errorf("invalid rpm package header")
+		}
+		size := int64(binary.BigEndian.Uint32(header[8:12]))*16 + int64(binary.BigEndian.Uint32(header[12:16]))
+		if pad && size%8 != 0 {
+			size += 8 - size%8
+		}
+		if _, err := io.CopyN(io.Discard, r, size); err != nil {
+			return fmt.Errorf("invalid rpm package: %w", err)
+		}
+	}
+	return nil
+}
+
+func (f *Filter) processCpio(name string, open opener) (*finalFile, opener, error) {
+	if len(f.opts.PackagePath) > 0 {
+		log.Debugf("Processing tag with PackagePath %s\n", f.opts.PackagePath)
+	}
+
+	var entries []archiveEntry
+	err := walkCpio(open, func(header *cpioHeader, _ io.Reader) bool {
+		entries = append(entries, archiveEntry{name: header.name, exec: header.mode&0o111 != 0})
+		return false
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f.selectFromArchive(name, "cpio", entries, func(file string) opener { return cpioMember(open, file) })
+}
+
+// cpioMember is the cpio counterpart of tarMember
+func cpioMember(open opener, selectedFile string) opener {
+	return func() (io.ReadCloser, error) {
+		rc, err := open()
+		if err != nil {
+			return nil, err
+		}
+		var found io.Reader
+		err = walkCpio(func() (io.ReadCloser, error) { return rc, nil }, func(header *cpioHeader, r io.Reader) bool {
+			if header.name == selectedFile {
+				found = r
+				return true
+			}
+			return false
+		})
+		if err == nil && found == nil {
+			err = fmt.Errorf("file %s not found in cpio archive", selectedFile)
+		}
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: found, close: rc.Close}, nil
+	}
+}
+
+type cpioHeader struct {
+	name string
+	mode int64
+	size int64
+}
+
+// walkCpio is the cpio counterpart of walkZip, only regular files are
+// passed to fn
+func walkCpio(open opener, fn func(*cpioHeader, io.Reader) bool) error {
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(rc)
+	for {
+		header, err := readCpioHeader(r)
+		if err != nil {
+			rc.Close()
+			return err
+		}
+		if header == nil {
+			rc.Close()
+			return nil
+		}
+		padding := (4 - header.size%4) % 4
+		if header.mode&0o170000 == 0o100000 {
+			if fn(header, io.LimitReader(r, header.size)) {
+				return nil
+			}
+		}
+		if _, err := io.CopyN(io.Discard, r, header.size+padding); err != nil {
+			rc.Close()
+			return err
+		}
+	}
+}
+
+// readCpioHeader returns nil at the end of the archive
+func readCpioHeader(r io.Reader) (*cpioHeader, error) {
+	raw := make([]byte, cpioHeaderSize)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, fmt.Errorf("invalid cpio archive: %w", err)
+	}
+	if string(raw[:6]) != "070701" && string(raw[:6]) != "070702" {
+		return nil, fmt.Errorf("unsupported cpio format")
+	}
+	field := func(i int) (int64, error) {
+		return strconv.ParseInt(string(raw[6+i*8:14+i*8]), 16, 64)
+	}
+	mode, err := field(1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cpio header: %w", err)
+	}
+	size, err := field(6)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cpio header: %w", err)
+	}
+	nameSize, err := field(11)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cpio header: %w", err)
+	}
+	// the name is NUL terminated and padded so
+	// the data starts at a multiple of 4
+	name := make([]byte, nameSize+(4-(cpioHeaderSize+nameSize)%4)%4)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, fmt.Errorf("invalid cpio archive: %w", err)
+	}
+	h := &cpioHeader{name: string(bytes.TrimRight(name[:nameSize], "\x00")), mode: mode, size: size}
+	if h.name == cpioTrailerName {
+		return nil, nil
+	}
+	return h, nil
+}
+
+// isPackageExt checks if filename is a .deb or .rpm
+// package. They're only considered when there's no
+// other archive or binary for the platform
+func isPackageExt(filename string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	return ext == "deb" || ext == "rpm"
+}
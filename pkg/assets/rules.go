@@ -0,0 +1,83 @@
+package assets
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/marcosnils/bin/pkg/config"
+)
+
+// scoringRule is a config.ScoringRule ready to be matched
+type scoringRule struct {
+	*config.ScoringRule
+	re *regexp.Regexp
+}
+
+func (r *scoringRule) matches(name string) bool {
+	if r.re != nil {
+		return r.re.MatchString(name)
+	}
+	return strings.Contains(strings.ToLower(name), strings.ToLower(r.Match))
+}
+
+// scoringRules returns the global rules followed by the
+// ones of the binary, compiling regexes the first time
+func (f *Filter) scoringRules() ([]*scoringRule, error) {
+	if f.rules != nil {
+		return f.rules, nil
+	}
+	rules := []*scoringRule{}
+	for _, r := range append(append([]*config.ScoringRule{}, config.Get().ScoringRules...), f.opts.ScoringRules...) {
+		sr := &scoringRule{ScoringRule: r}
+		if r.Regex {
+			re, err := regexp.Compile("(?i)" + r.Match)
+			if err != nil {
+				return nil, fmt.Errorf("invalid scoring rule regex %q: %w", r.Match, err)
+			}
+			sr.re = re
+		}
+		rules = append(rules, sr)
+	}
+	f.rules = rules
+	return rules, nil
+}
+
+// applyExcludeRules removes the assets matching any exclude rule
+func (f *Filter) applyExcludeRules(as []*Asset) ([]*Asset, error) {
+	rules, err := f.scoringRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []*Asset
+assets:
+	for _, a := range as {
+		for _, r := range rules {
+			if r.Exclude && r.matches(a.Name) {
+				log.Debugf("Excluding %s, it matches scoring rule %s", a.Name, r)
+				continue assets
+			}
+		}
+		kept = append(kept, a)
+	}
+	if len(kept) == 0 && len(as) > 0 {
+		return nil, fmt.Errorf("all candidates were excluded by scoring rules")
+	}
+	return kept, nil
+}
+
+// ruleScore returns the points the scoring rules add to name
+func (f *Filter) ruleScore(name string) int {
+	// invalid rules are reported by applyExcludeRules
+	rules, _ := f.scoringRules()
+	total := 0
+	for _, r := range rules {
+		if !r.Exclude && r.matches(name) {
+			log.Debugf("Candidate %s matches scoring rule %s. Adding score %d", name, r, r.Score)
+			total += r.Score
+		}
+	}
+	return total
+}
@@ -0,0 +1,453 @@
+// Package cache keeps the release assets bin downloads, so binaries
+// can be installed again without downloading them. Assets are stored
+// by the sha256 of their content and indexed by the URL they were
+// downloaded from.
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/marcosnils/bin/pkg/config"
+)
+
+// DefaultMaxSize is the size the cache is pruned to
+// when download_cache.max_size isn't set
+const DefaultMaxSize = 2 << 30
+
+// ErrNotCached is returned when an asset isn't in the cache
+var ErrNotCached = errors.New("not in the download cache")
+
+// Entry is a cached download
+type Entry struct {
+	URL  string `json:"url"`
+	Name string `json:"name"`
+	// Digest is the hex encoded sha256 of the asset
+	Digest string    `json:"digest"`
+	Size   int64     `json:"size"`
+	Used   time.Time `json:"used"`
+	// ETag is the one of the response, used to check
+	// if the content of the URL changed before reusing it
+	ETag string `json:"etag,omitempty"`
+}
+
+// index maps the downloaded URLs to their entries,
+// several URLs can have the same content
+type index struct {
+	Entries map[string]*Entry `json:"entries"`
+}
+
+var (
+	// mu serializes the changes to the index in this
+	// process, the lock of the index those of others
+	mu sync.Mutex
+	// inUse are the digests of the assets read by this
+	// process, they're not evicted when storing others
+	inUse = map[string]bool{}
+	now   = time.Now
+)
+
+// Dir returns the directory of the download cache
+func Dir() (string, error) {
+	d, err := config.GetCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "downloads"), nil
+}
+
+func blobPath(dir, digest string) string {
+	return filepath.Join(dir, "sha256", digest)
+}
+
+// Lookup returns the cached download of url and its path. Since
+// the content of a URL can change, it's only returned when size
+// is known and matches the cached one, as well as digest if the
+// provider reports it. Otherwise callers must check that the
+// content didn't change, e.g. with the ETag of the entry.
+func Lookup(url string, size int64, digest string) (*Entry, string, bool) {
+	if size <= 0 {
+		return nil, "", false
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	dir, idx, unlock, err := loadIndex(true)
+	if err != nil {
+		return nil, "", false
+	}
+	defer unlock()
+	e, ok := idx.Entries[url]
+	if !ok || e.Size != size || (digest != "" && e.Digest != digest) {
+		return nil, "", false
+	}
+	p := blobPath(dir, e.Digest)
+	if fi, err := os.Stat(p); err != nil || fi.Size() != size {
+		return nil, "", false
+	}
+	idx.use(e)
+	if err := idx.save(dir); err != nil {
+		log.Debugf("Error saving the download cache index: %v", err)
+	}
+	return e, p, true
+}
+
+// Get returns the cached asset with digest and its path
+func Get(digest string) (*Entry, string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	dir, idx, unlock, err := loadIndex(true)
+	if err != nil {
+		return nil, "", err
+	}
+	defer unlock()
+	for _, e := range idx.sorted() {
+		if e.Digest != digest {
+			continue
+		}
+		p := blobPath(dir, digest)
+		if _, err := os.Stat(p); err != nil {
+			break
+		}
+		idx.use(e)
+		if err := idx.save(dir); err != nil {
+			log.Debugf("Error saving the download cache index: %v", err)
+		}
+		return e, p, nil
+	}
+	return nil, "", fmt.Errorf("asset %s is %w", digest, ErrNotCached)
+}
+
+// Store copies the file at path, downloaded from url with the
+// given ETag, into the cache and prunes it to the configured size.
+// Nothing is stored if the cache is disabled.
+func Store(url, name, path, digest, etag string) error {
+	settings := config.Get().DownloadCache
+	if settings != nil && settings.Disabled {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	dir, idx, unlock, err := loadIndex(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	blob := blobPath(dir, digest)
+	if _, err := os.Stat(blob); err != nil {
+		if err := copyFile(path, blob); err != nil {
+			return err
+		}
+	}
+
+	e := &Entry{URL: url, Name: name, Digest: digest, Size: fi.Size(), ETag: etag}
+	idx.Entries[url] = e
+	idx.use(e)
+	if _, err := idx.prune(dir, MaxSize(), 0); err != nil {
+		return err
+	}
+	return idx.save(dir)
+}
+
+// MaxSize returns the configured size of the cache
+func MaxSize() int64 {
+	settings := config.Get().DownloadCache
+	if settings == nil || settings.MaxSize == "" {
+		return DefaultMaxSize
+	}
+	size, err := ParseSize(settings.MaxSize)
+	if err != nil {
+		log.Warnf("Ignoring the download_cache max_size: %v", err)
+		return DefaultMaxSize
+	}
+	return size
+}
+
+// List returns the cached downloads, the most recently used first
+func List() ([]*Entry, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	_, idx, unlock, err := loadIndex(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return idx.sorted(), nil
+}
+
+// Clear removes every cached download
+func Clear() error {
+	mu.Lock()
+	defer mu.Unlock()
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	unlock, err := lockIndex(dir, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// the lock file is kept, other processes might be waiting on it
+	if err := os.RemoveAll(filepath.Join(dir, "sha256")); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, "index.json")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Prune removes the downloads that weren't used in the last
+// unusedFor, if it's not zero, and then the least recently used
+// ones until the cache takes less than maxSize. It returns the
+// removed entries.
+func Prune(maxSize int64, unusedFor time.Duration) ([]*Entry, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	dir, idx, unlock, err := loadIndex(true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	removed, err := idx.prune(dir, maxSize, unusedFor)
+	if err != nil {
+		return nil, err
+	}
+	return removed, idx.save(dir)
+}
+
+// TotalSize returns the size of the different assets of entries
+func TotalSize(entries []*Entry) int64 {
+	var size int64
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if !seen[e.Digest] {
+			seen[e.Digest] = true
+			size += e.Size
+		}
+	}
+	return size
+}
+
+// lockIndex takes the lock of the index in dir, shared by the
+// bin processes using the cache, and returns its release function
+func lockIndex(dir string, exclusive bool) (func(), error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return config.LockFile(filepath.Join(dir, "index.json"), exclusive)
+}
+
+// loadIndex locks the index, exclusively to change it, and reads
+// it. The lock must be released with the returned function once
+// the changes are saved, so other bin processes don't lose them
+// or remove the assets they add.
+func loadIndex(exclusive bool) (string, *index, func(), error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	unlock, err := lockIndex(dir, exclusive)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	idx := &index{Entries: map[string]*Entry{}}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dir, idx, unlock, nil
+		}
+		unlock()
+		return "", nil, nil, err
+	}
+	if err := json.Unmarshal(data, idx); err != nil {
+		log.Debugf("Ignoring invalid download cache index: %v", err)
+		return dir, &index{Entries: map[string]*Entry{}}, unlock, nil
+	}
+	if idx.Entries == nil {
+		idx.Entries = map[string]*Entry{}
+	}
+	return dir, idx, unlock, nil
+}
+
+// save writes the index to a temp file first so
+// it's never left half written
+func (idx *index) save(dir string) error {
+	data, err := json.MarshalIndent(idx, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".index-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, "index.json"))
+}
+
+// use marks e as used now, and by this process
+func (idx *index) use(e *Entry) {
+	t := now()
+	// the URLs of the same asset share its last use
+	for _, o := range idx.Entries {
+		if o.Digest == e.Digest {
+			o.Used = t
+		}
+	}
+	e.Used = t
+	inUse[e.Digest] = true
+}
+
+// sorted returns the entries, the most recently used first
+func (idx *index) sorted() []*Entry {
+	entries := make([]*Entry, 0, len(idx.Entries))
+	for _, e := range idx.Entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Used.Equal(entries[j].Used) {
+			return entries[i].Used.After(entries[j].Used)
+		}
+		return entries[i].URL < entries[j].URL
+	})
+	return entries
+}
+
+// prune removes the entries as described in Prune, skipping the ones
+// in use, and the assets that aren't referenced by any entry
+func (idx *index) prune(dir string, maxSize int64, unusedFor time.Duration) ([]*Entry, error) {
+	var removed []*Entry
+	remove := func(e *Entry) {
+		delete(idx.Entries, e.URL)
+		removed = append(removed, e)
+	}
+
+	entries := idx.sorted()
+	if unusedFor > 0 {
+		for _, e := range entries {
+			if !inUse[e.Digest] && now().Sub(e.Used) > unusedFor {
+				remove(e)
+			}
+		}
+	}
+
+	entries = idx.sorted()
+	size := TotalSize(entries)
+	for i := len(entries) - 1; i >= 0 && size > maxSize; i-- {
+		e := entries[i]
+		if inUse[e.Digest] {
+			continue
+		}
+		remove(e)
+		if !idx.references(e.Digest) {
+			size -= e.Size
+		}
+	}
+
+	blobs, err := os.ReadDir(filepath.Join(dir, "sha256"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, b := range blobs {
+		if !idx.references(b.Name()) && !inUse[b.Name()] {
+			if err := os.Remove(filepath.Join(dir, "sha256", b.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return removed, nil
+}
+
+func (idx *index) references(digest string) bool {
+	for _, e := range idx.Entries {
+		if e.Digest == digest {
+			return true
+		}
+	}
+	return false
+}
+
+// copyFile copies src to dst through a temp file, so
+// partial copies are never visible at dst
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".blob-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"tib": 1 << 40,
+}
+
+// ParseSize parses sizes like 512MB, 2GiB or 1g
+func ParseSize(s string) (int64, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	i := strings.IndexFunc(v, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(v)
+	}
+	n, err := strconv.ParseFloat(v[:i], 64)
+	unit, ok := sizeUnits[strings.TrimSpace(v[i:])]
+	if err != nil || !ok || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
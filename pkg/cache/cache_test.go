@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marcosnils/bin/pkg/config"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestCache(t *testing.T) {
+	t.Setenv("BIN_CACHE_DIR", t.TempDir())
+	src := t.TempDir()
+	defer func() { now, inUse = time.Now, map[string]bool{} }()
+
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+
+	if err := Store("https://example.com/a", "a.tar.gz", writeFile(t, src, "a", "aaaa"), "da", ""); err != nil {
+		t.Fatal(err)
+	}
+	clock = clock.Add(time.Hour)
+	if err := Store("https://example.com/b", "b.tar.gz", writeFile(t, src, "b", "bbbbbb"), "db", ""); err != nil {
+		t.Fatal(err)
+	}
+	// the same content from another URL
+	if err := Store("https://mirror.example.com/b", "b.tar.gz", writeFile(t, src, "b2", "bbbbbb"), "db", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	clock = clock.Add(time.Hour)
+	if _, _, ok := Lookup("https://example.com/a", 0, ""); ok {
+		t.Error("downloads without a known size shouldn't be reused")
+	}
+	if _, _, ok := Lookup("https://example.com/a", 5, ""); ok {
+		t.Error("downloads with another size shouldn't be reused")
+	}
+	if _, _, ok := Lookup("https://example.com/a", 4, "other"); ok {
+		t.Error("downloads with another digest shouldn't be reused")
+	}
+	e, p, ok := Lookup("https://example.com/a", 4, "da")
+	if !ok || e.Digest != "da" {
+		t.Fatalf("expected a cached download, got %v", e)
+	}
+	if data, _ := os.ReadFile(p); string(data) != "aaaa" {
+		t.Errorf("unexpected cached content %q", data)
+	}
+
+	clock = clock.Add(time.Hour)
+	if _, _, err := Get("missing"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("expected ErrNotCached, got %v", err)
+	}
+	if e, _, err := Get("db"); err != nil || e.Name != "b.tar.gz" {
+		t.Errorf("unexpected entry %v: %v", e, err)
+	}
+
+	entries, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || TotalSize(entries) != 10 {
+		t.Errorf("expected 3 entries of 10 bytes, got %d of %d", len(entries), TotalSize(entries))
+	}
+
+	// assets used by this process are never pruned
+	inUse = map[string]bool{}
+	clock = clock.Add(2 * time.Hour)
+	removed, err := Prune(8, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Digest != "da" {
+		t.Errorf("expected the least recently used download to be removed, got %v", removed)
+	}
+	removed, err = Prune(100, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("expected the unused downloads to be removed, got %v", removed)
+	}
+	dir, _ := Dir()
+	if blobs, _ := os.ReadDir(filepath.Join(dir, "sha256")); len(blobs) != 0 {
+		t.Errorf("expected the assets to be removed, got %v", blobs)
+	}
+
+	if err := Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := List(); err != nil || len(entries) != 0 {
+		t.Errorf("expected an empty cache, got %v: %v", entries, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sha256")); !os.IsNotExist(err) {
+		t.Errorf("expected the assets of %s to be removed", dir)
+	}
+}
+
+func TestCacheLock(t *testing.T) {
+	t.Setenv("BIN_CACHE_DIR", t.TempDir())
+	defer func() { inUse = map[string]bool{} }()
+	dir, _ := Dir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// another bin process changing the index
+	unlock, err := config.LockFile(filepath.Join(dir, "index.json"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := writeFile(t, t.TempDir(), "a", "aaaa")
+	done := make(chan error)
+	go func() {
+		done <- Store("https://example.com/a", "a.tar.gz", src, "da", "")
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("the index was changed while locked: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Get("da"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"1024":  1024,
+		"500MB": 500 * 1000 * 1000,
+		"2GiB":  2 << 30,
+		"1.5 g": 3 << 29,
+		"10kb":  10000,
+		"0":     0,
+		" 64m ": 64 << 20,
+	}
+	for in, want := range cases {
+		got, err := ParseSize(in)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+		} else if got != want {
+			t.Errorf("%q: got %d, want %d", in, got, want)
+		}
+	}
+	for _, in := range []string{"", "MB", "1XB", "-1GB"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
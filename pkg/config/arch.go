@@ -0,0 +1,177 @@
+package config
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/caarlos0/log"
+	"golang.org/x/sys/cpu"
+)
+
+// archAliases are the other names releases use for each GOARCH
+var archAliases = map[string][]string{
+	"386":      {"i386", "i486", "i586", "i686", "x86", "ia32"},
+	"amd64":    {"x86_64", "x86-64", "x64"},
+	"arm64":    {"aarch64", "armv8", "aarch_64"},
+	"loong64":  {"loongarch64"},
+	"mipsle":   {"mipsel"},
+	"mips64le": {"mips64el"},
+	"ppc64":    {"powerpc64"},
+	"ppc64le":  {"powerpc64le", "ppc64el"},
+	"riscv64":  {"riscv"},
+	"s390x":    {"s390"},
+}
+
+// archConflicts are names of other architectures that contain
+// the name of the host one, like x86_64 for x86 or arm64 for arm
+var archConflicts = map[string][]string{
+	"386":     {"x86_64", "x86-64", "amd64", "x64"},
+	"arm":     {"arm64", "aarch64", "armv8"},
+	"mips":    {"mips64", "mipsle", "mipsel"},
+	"mips64":  {"mips64le", "mips64el"},
+	"ppc64":   {"ppc64le", "ppc64el", "powerpc64le"},
+	"riscv64": {"riscv32"},
+}
+
+// incompatibleArchScore is low enough to drop any
+// asset built for an incompatible architecture
+const incompatibleArchScore = -50
+
+var (
+	archVariantsOnce sync.Once
+	archVariants     map[string]int
+)
+
+// hostArchLevel returns the ARM version or the x86-64
+// microarchitecture level of the host CPU
+func hostArchLevel() int {
+	var level int
+	switch runtime.GOARCH {
+	case "arm":
+		level = armVersion()
+		log.Debugf("Detected ARM version: %d", level)
+	case "amd64":
+		level = amd64Level()
+		log.Debugf("Detected x86-64 microarchitecture level: v%d", level)
+	}
+	return level
+}
+
+// ArchVariants returns the variants of goarch for a CPU of the given
+// level: the ARM version for arm, the microarchitecture level for
+// amd64, ignored for other architectures
+func ArchVariants(goarch string, level int) map[string]int {
+	variants := map[string]int{}
+	for _, name := range archConflicts[goarch] {
+		variants[name] = incompatibleArchScore
+	}
+	switch goarch {
+	case "arm":
+		for v := 5; v <= 7; v++ {
+			score := v - 4
+			if v > level {
+				score = incompatibleArchScore
+			}
+			for _, name := range []string{"armv" + strconv.Itoa(v), "arm" + strconv.Itoa(v), "arm_" + strconv.Itoa(v), "arm-" + strconv.Itoa(v)} {
+				variants[name] = score
+			}
+		}
+		// debian names hard and soft float builds after the ABI
+		variants["armel"] = variants["armv5"]
+		variants["armhf"] = variants["armv7"]
+	case "arm64":
+		// Apple's pointer authentication ABI, only
+		// picked when there's no plain arm64 build
+		variants["arm64e"] = -1
+	case "amd64":
+		for v := 1; v <= 4; v++ {
+			score := v
+			if v > level {
+				score = incompatibleArchScore
+			}
+			for _, arch := range []string{"x86_64", "x86-64", "amd64"} {
+				for _, sep := range []string{"_v", "-v", "v"} {
+					variants[arch+sep+strconv.Itoa(v)] = score
+				}
+			}
+		}
+	}
+	return variants
+}
+
+// armVersion returns the ARM version of the CPU from /proc/cpuinfo,
+// falling back to the GOARM bin was built with
+func armVersion() int {
+	if f, err := os.Open("/proc/cpuinfo"); err == nil {
+		defer f.Close()
+		if v := parseCPUInfoARMVersion(f); v > 0 {
+			return v
+		}
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "GOARM" {
+				if v, err := strconv.Atoi(strings.SplitN(s.Value, ",", 2)[0]); err == nil {
+					return v
+				}
+			}
+		}
+	}
+	// the default of the go toolchain
+	return 7
+}
+
+// parseCPUInfoARMVersion reads the "CPU architecture" of /proc/cpuinfo.
+// ARMv8 CPUs running 32 bits binaries run ARMv7 ones too.
+func parseCPUInfoARMVersion(r io.Reader) int {
+	version := 0
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.ToLower(strings.TrimSpace(value))
+		switch strings.TrimSpace(key) {
+		case "model name":
+			// the ARMv6 CPU of the first Raspberry Pis
+			// reports its architecture as 7
+			if strings.HasPrefix(value, "armv6") {
+				return 6
+			}
+		case "CPU architecture":
+			if version > 0 {
+				continue
+			}
+			// some kernels report it as "7" and others as "ARMv7"
+			value = strings.TrimPrefix(value, "armv")
+			if v, err := strconv.Atoi(strings.TrimRight(value, "abcdefghijklmnopqrstuvwxyz")); err == nil {
+				version = min(v, 7)
+			}
+		}
+	}
+	return version
+}
+
+// amd64Level returns the x86-64 microarchitecture level
+// (https://en.wikipedia.org/wiki/X86-64#Microarchitecture_levels)
+// supported by the CPU
+func amd64Level() int {
+	x := cpu.X86
+	if !(x.HasCX16 && x.HasPOPCNT && x.HasSSE3 && x.HasSSSE3 && x.HasSSE41 && x.HasSSE42) {
+		return 1
+	}
+	if !(x.HasAVX && x.HasAVX2 && x.HasBMI1 && x.HasBMI2 && x.HasFMA && x.HasOSXSAVE) {
+		return 2
+	}
+	if !(x.HasAVX512F && x.HasAVX512BW && x.HasAVX512CD && x.HasAVX512DQ && x.HasAVX512VL) {
+		return 3
+	}
+	return 4
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCPUInfoARMVersion(t *testing.T) {
+	cases := map[string]int{
+		"processor\t: 0\nmodel name\t: ARMv6-compatible processor rev 7 (v6l)\nCPU architecture: 7\n": 6,
+		"processor\t: 0\nCPU architecture: 6TEJ\n":                                                    6,
+		"processor\t: 0\nCPU architecture: 8\n":                                                       7,
+		"processor\t: 0\nCPU architecture: ARMv7\n":                                                   7,
+		"processor\t: 0\n": 0,
+	}
+	for cpuinfo, want := range cases {
+		if got := parseCPUInfoARMVersion(strings.NewReader(cpuinfo)); got != want {
+			t.Errorf("%q: got %d, want %d", cpuinfo, got, want)
+		}
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	cases := []struct {
+		os, arch, libc string
+		want           string
+		variant        string
+	}{
+		{"linux", "aarch64", "musl", "linux/aarch64 (musl)", ""},
+		{"macos", "x86_64_v3", "", "darwin/x86_64_v3", "amd64v3"},
+		{"Linux", "armhf", "gnu", "linux/armhf (glibc)", "armv7"},
+		{"linux", "armv6l", "", "linux/armv6l", "armv6"},
+	}
+	for _, c := range cases {
+		target, err := ParseTarget(c.os, c.arch, c.libc)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", c.os, c.arch, err)
+		}
+		if target.String() != c.want {
+			t.Errorf("got %s, want %s", target, c.want)
+		}
+		if c.variant != "" && target.GetArchVariants()[c.variant] <= 0 {
+			t.Errorf("%s: %s isn't a compatible variant", target, c.variant)
+		}
+	}
+
+	for _, c := range [][3]string{{"beos", "", ""}, {"linux", "sparc", ""}, {"darwin", "arm64", "musl"}} {
+		if _, err := ParseTarget(c[0], c[1], c[2]); err == nil {
+			t.Errorf("%v: expected an error", c)
+		}
+	}
+}
@@ -2,26 +2,110 @@ package config
 
 import (
 	"bufio"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path"
 	"path/filepath"
-	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/caarlos0/log"
+	"github.com/marcosnils/bin/pkg/options"
 )
 
 var cfg config
 
+// mu guards the binaries of cfg and its writes, since
+// update and ensure process several binaries at once
+var mu sync.RWMutex
+
 type config struct {
 	// DefaultPath might not be expanded so it's important that
 	// the caller expands this variable with os.ExpandEnv(string)
 	// if necessary
 	DefaultPath string             `json:"default_path"`
 	Bins        map[string]*Binary `json:"bins"`
+	// URLRewrites maps URL prefixes to the prefix they should be
+	// replaced with before making any request, e.g. to go through
+	// an internal mirror. Binaries keep their original URLs.
+	URLRewrites map[string]string `json:"url_rewrites,omitempty"`
+	// Credentials holds per host tokens or credential helpers
+	Credentials map[string]*Credential `json:"credentials,omitempty"`
+	// CredentialHelper is a git-credential style command used
+	// for hosts without a specific helper
+	CredentialHelper string `json:"credential_helper,omitempty"`
+	// GitHubHosts holds the API and upload URLs of GitHub
+	// Enterprise Server instances keyed by hostname
+	GitHubHosts map[string]*GitHubHost `json:"github_hosts,omitempty"`
+	// ScoringRules adjust the score of release assets for every
+	// binary, binaries can add their own rules
+	ScoringRules []*ScoringRule `json:"scoring_rules,omitempty"`
+	// Target is the platform the binaries of this config are
+	// selected for, the host one if it's not set
+	Target *Target `json:"target,omitempty"`
+	// DownloadCache configures the cache of downloaded
+	// release assets
+	DownloadCache *DownloadCache `json:"download_cache,omitempty"`
+	// Download configures the retries and timeouts
+	// of the downloads of release assets
+	Download *Download `json:"download,omitempty"`
+}
+
+// Download configures the retries and timeouts of the downloads
+// of release assets, the zero values use the defaults
+type Download struct {
+	// Retries is the number of times a download is retried
+	// after transient errors, -1 disables the retries
+	Retries int `json:"retries,omitempty"`
+	// RetryWait is the wait before the first retry, like
+	// 2s, it doubles on each retry
+	RetryWait string `json:"retry_wait,omitempty"`
+	// Timeout is how long a download can go without
+	// receiving any data, like 1m
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// DownloadCache configures the cache of downloaded release assets
+type DownloadCache struct {
+	// MaxSize is the size the cache is pruned to after each
+	// download, like 500MB or 2GiB
+	MaxSize string `json:"max_size,omitempty"`
+	// Disabled stops caching new downloads
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// ScoringRule adds Score points to the assets matching it, or
+// excludes them altogether if Exclude is set
+type ScoringRule struct {
+	// Match is a case insensitive substring, or a
+	// regular expression if Regex is set
+	Match   string `json:"match"`
+	Regex   bool   `json:"regex,omitempty"`
+	Score   int    `json:"score,omitempty"`
+	Exclude bool   `json:"exclude,omitempty"`
+}
+
+func (r *ScoringRule) String() string {
+	kind := "substring"
+	if r.Regex {
+		kind = "regex"
+	}
+	if r.Exclude {
+		return fmt.Sprintf("exclude %s %q", kind, r.Match)
+	}
+	return fmt.Sprintf("%s %q (%+d)", kind, r.Match, r.Score)
+}
+
+type GitHubHost struct {
+	APIURL    string `json:"api_url"`
+	UploadURL string `json:"upload_url"`
+}
+
+type Credential struct {
+	Token  string `json:"token,omitempty"`
+	Helper string `json:"helper,omitempty"`
 }
 
 type Binary struct {
@@ -36,6 +120,32 @@ type Binary struct {
 	// the path again when upgrading
 	PackagePath string `json:"package_path"`
 	Pinned      bool   `json:"pinned"`
+	// Digest is the sha256 of the release asset the binary
+	// was extracted from, used to restore it from the
+	// download cache
+	Digest string `json:"digest,omitempty"`
+	// NamePattern is the glob used to select the release
+	// asset, followed by the one of the archive file after
+	// a slash, see FilterOpts.NamePattern
+	NamePattern string `json:"name_pattern,omitempty"`
+	// All is set when the asset was picked from all the
+	// assets of the release, skipping the scoring
+	All bool `json:"all,omitempty"`
+	// Group identifies binaries installed together from the
+	// same archive, they're updated and removed as a whole.
+	// It's "<url> in <dir>", the URL the group was first
+	// installed from and the directory it was installed into.
+	Group string `json:"group,omitempty"`
+	// Files are the patterns used to select the group
+	// files from the archive
+	Files []string `json:"files,omitempty"`
+	// InstallExtras is set when the completions and man pages
+	// of the binary were requested, Extras are their paths
+	InstallExtras bool     `json:"install_extras,omitempty"`
+	Extras        []string `json:"extras,omitempty"`
+	// ScoringRules are applied after the global ones
+	// when updating this binary
+	ScoringRules []*ScoringRule `json:"scoring_rules,omitempty"`
 }
 
 func CheckAndLoad() error {
@@ -51,24 +161,28 @@ func CheckAndLoad() error {
 	}
 
 	log.Debugf("Config directory is: %s", confDir)
-	f, err := os.OpenFile(configPath, os.O_RDWR|os.O_CREATE, 0664)
-	if err != nil && !os.IsNotExist(err) {
+	unlock, err := LockFile(resolveConfigPath(configPath), false)
+	if err != nil {
 		return err
 	}
-
-	defer f.Close()
-
-	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
-		if err == io.EOF {
-			// Empty file and/or was just created, initialize cfg.Bins
-			cfg.Bins = map[string]*Binary{}
-		} else {
-			return err
-		}
+	loaded, _, err := readConfig(resolveConfigPath(configPath))
+	unlock()
+	if err != nil {
+		return err
+	}
+	if loaded != nil {
+		cfg = *loaded
 	}
 
 	if len(cfg.DefaultPath) == 0 {
 		cfg.DefaultPath, err = getDefaultPath()
+		if ae := (*options.AmbiguousError)(nil); errors.As(err, &ae) {
+			ae.Hint = fmt.Sprintf("Set \"default_path\" in %s to pick one", configPath)
+			return ae
+		}
+		if err != nil && !options.Interactive() {
+			return fmt.Errorf("could not find a download directory in PATH, set \"default_path\" in %s: %w", configPath, options.ErrNonInteractive)
+		}
 		if err != nil {
 			for {
 				log.Info("Could not find a PATH directory automatically, falling back to manual selection")
@@ -92,7 +206,8 @@ func CheckAndLoad() error {
 			}
 		}
 
-		if err := write(); err != nil {
+		defaultPath := cfg.DefaultPath
+		if err := save(func(c *config) { c.DefaultPath = defaultPath }); err != nil {
 			return err
 		}
 
@@ -102,6 +217,14 @@ func CheckAndLoad() error {
 		cfg.Bins = map[string]*Binary{}
 	}
 
+	if cfg.Target != nil {
+		if cfg.Target, err = ParseTarget(cfg.Target.OS, cfg.Target.Arch, cfg.Target.Libc); err != nil {
+			return fmt.Errorf("invalid target in config file: %w", err)
+		}
+		target = cfg.Target
+		log.Debugf("Selecting binaries for %s", target)
+	}
+
 	log.Debugf("Download path set to %s", cfg.DefaultPath)
 	return nil
 }
@@ -110,12 +233,22 @@ func Get() *config {
 	return &cfg
 }
 
+// GetBinary returns the binary installed at path, it's
+// safe to use while other binaries are being updated
+func GetBinary(path string) (*Binary, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	b, ok := cfg.Bins[path]
+	return b, ok
+}
+
 // UpsertBinary adds or updats an existing
 // binary resource in the config
 func UpsertBinary(c *Binary) error {
+	mu.Lock()
+	defer mu.Unlock()
 	if c != nil {
-		cfg.Bins[c.Path] = c
-		err := write()
+		err := save(func(cfg *config) { cfg.Bins[c.Path] = c })
 		if err != nil {
 			return err
 		}
@@ -124,65 +257,79 @@ func UpsertBinary(c *Binary) error {
 	return nil
 }
 
+// UpsertBinaries adds or updates several binaries
+// writing the config once
+func UpsertBinaries(bins []*Binary) error {
+	mu.Lock()
+	defer mu.Unlock()
+	return save(func(c *config) {
+		for _, b := range bins {
+			c.Bins[b.Path] = b
+		}
+	})
+}
+
+// GroupMembers returns the binaries of group sorted by path
+func GroupMembers(group string) []*Binary {
+	mu.RLock()
+	defer mu.RUnlock()
+	var members []*Binary
+	for _, b := range cfg.Bins {
+		if b.Group == group {
+			members = append(members, b)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Path < members[j].Path })
+	return members
+}
+
 // RemoveBinaries removes the specified paths
 // from bin configuration. It doesn't care about the order
 func RemoveBinaries(paths []string) error {
-	for _, p := range paths {
-		delete(cfg.Bins, p)
-	}
-
-	return write()
+	mu.Lock()
+	defer mu.Unlock()
+	return save(func(c *config) {
+		for _, p := range paths {
+			delete(c.Bins, p)
+		}
+	})
 }
 
-func write() error {
-	configPath, err := getConfigPath()
-	if err != nil {
-		return err
-	}
-
-	f, err := os.OpenFile(configPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0664)
-	if err != nil {
-		return err
+// RewriteURL applies the longest matching URLRewrites prefix
+// to u. It returns u unchanged if there are no matching rules.
+func RewriteURL(u string) string {
+	var from string
+	for prefix := range cfg.URLRewrites {
+		if strings.HasPrefix(u, prefix) && len(prefix) > len(from) {
+			from = prefix
+		}
 	}
-
-	defer f.Close()
-
-	decoder := json.NewEncoder(f)
-	decoder.SetIndent("", "    ")
-	err = decoder.Encode(cfg)
-	if err != nil {
-		return err
+	if from == "" {
+		return u
 	}
-
-	return nil
+	rewritten := cfg.URLRewrites[from] + strings.TrimPrefix(u, from)
+	log.Debugf("Rewriting URL %s to %s", u, rewritten)
+	return rewritten
 }
 
-// GetArch is the running program's operating system target:
-// one of darwin, freebsd, linux, and so on.
-func GetArch() []string {
-	res := []string{runtime.GOARCH}
-	if runtime.GOARCH == "amd64" {
-		// Adding x86_64 manually since the uname syscall (man 2 uname)
-		// is not implemented in all systems
-		res = append(res, "x86_64")
-		res = append(res, "x64")
-	}
-	return res
+// customConfigPath is the config file set with SetPath
+var customConfigPath string
+
+// SetPath makes bin use the config file at p, which
+// is created if it doesn't exist
+func SetPath(p string) {
+	customConfigPath = p
 }
 
-// GetOS is the running program's architecture target:
-// one of 386, amd64, arm, s390x, and so on.
-func GetOS() []string {
-	res := []string{runtime.GOOS}
-	if runtime.GOOS == "windows" {
-		// Adding win since some repositories release with that as the indicator of a windows binary
-		res = append(res, "win")
-	}
-	return res
+// IsCustomPath checks if the config file was chosen
+// with SetPath or BIN_CONFIG
+func IsCustomPath() bool {
+	return len(customConfigPath) > 0 || len(os.Getenv("BIN_CONFIG")) > 0
 }
 
 // getConfigPath returns the path to the configuration directory respecting
 // the `XDG Base Directory specification` using the following strategy:
+//   - honor the file set with SetPath
 //   - honor BIN_CONFIG is set
 //   - to prevent breaking of existing configurations, check if "$HOME/.bin/config.json"
 //     exists and return "$HOME/.bin"
@@ -194,6 +341,9 @@ func GetOS() []string {
 //
 //	%APPDATA% might be the right place on windows
 func getConfigPath() (string, error) {
+	if len(customConfigPath) > 0 {
+		return customConfigPath, nil
+	}
 
 	c := os.Getenv("BIN_CONFIG")
 	if len(c) > 0 {
@@ -227,13 +377,43 @@ func getConfigPath() (string, error) {
 	return filepath.Join(home, ".bin", "config.json"), nil
 }
 
-func GetOSSpecificExtensions() []string {
-	switch runtime.GOOS {
-	case "linux":
-		return []string{"AppImage"}
-	case "windows":
-		return []string{"exe"}
-	default:
-		return nil
+// GetPluginsDir returns the directory where bin looks for
+// bin-provider-<id> executables. It honors BIN_PLUGINS_DIR and
+// defaults to the "plugins" directory next to the config file.
+func GetPluginsDir() (string, error) {
+	if d := os.Getenv("BIN_PLUGINS_DIR"); len(d) > 0 {
+		return d, nil
+	}
+	c, err := getConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(c), "plugins"), nil
+}
+
+// GetCacheDir returns the directory where bin caches data. It honors
+// BIN_CACHE_DIR and defaults to the "bin" directory in the user cache dir.
+func GetCacheDir() (string, error) {
+	if d := os.Getenv("BIN_CACHE_DIR"); len(d) > 0 {
+		return d, nil
+	}
+	c, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(c, "bin"), nil
+}
+
+// GetDataDir returns the XDG data directory where completions and man
+// pages are installed. It honors XDG_DATA_HOME and defaults to
+// ~/.local/share.
+func GetDataDir() (string, error) {
+	if d := os.Getenv("XDG_DATA_HOME"); len(d) > 0 {
+		return d, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
 	}
+	return filepath.Join(home, ".local", "share"), nil
 }
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/caarlos0/log"
@@ -46,6 +47,7 @@ func getDefaultPath() (string, error) {
 	for k := range opts {
 		sopts = append(sopts, k)
 	}
+	sort.Slice(sopts, func(i, j int) bool { return sopts[i].String() < sopts[j].String() })
 
 	choice, err := options.SelectCustom("Pick a default download dir: ", sopts)
 	if err != nil {
@@ -64,3 +66,29 @@ func checkDirExistsAndWritable(dir string) error {
 	err := unix.Access(dir, unix.W_OK)
 	return err
 }
+
+// lockFile takes the flock of f, failing
+// with errLocked if it's taken and !wait
+func lockFile(f *os.File, exclusive, wait bool) error {
+	how := unix.LOCK_SH
+	if exclusive {
+		how = unix.LOCK_EX
+	}
+	if !wait {
+		how |= unix.LOCK_NB
+	}
+	for {
+		err := unix.Flock(int(f.Fd()), how)
+		if err == unix.EINTR {
+			continue
+		}
+		if err == unix.EWOULDBLOCK {
+			return errLocked
+		}
+		return err
+	}
+}
+
+func unlockFile(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/caarlos0/log"
 	"github.com/marcosnils/bin/pkg/options"
+	"golang.org/x/sys/windows"
 )
 
 // getDefaultPath reads the user's PATH variable
@@ -39,6 +41,7 @@ func getDefaultPath() (string, error) {
 	for k := range opts {
 		sopts = append(sopts, k)
 	}
+	sort.Slice(sopts, func(i, j int) bool { return sopts[i].String() < sopts[j].String() })
 
 	choice, err := options.SelectCustom("Pick a default download dir: ", sopts)
 	if err != nil {
@@ -62,3 +65,24 @@ func checkDirExistsAndWritable(dir string) error {
 	return nil
 
 }
+
+// lockFile locks the first byte of f, failing
+// with errLocked if it's locked and !wait
+func lockFile(f *os.File, exclusive, wait bool) error {
+	var flags uint32
+	if exclusive {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	if !wait {
+		flags |= windows.LOCKFILE_FAIL_IMMEDIATELY
+	}
+	err := windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, 1, 0, &windows.Overlapped{})
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return errLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/caarlos0/log"
+)
+
+// keepBackups is how many previous versions of the config file
+// are kept next to it, from config.json.1 (the newest) to .3
+const keepBackups = 3
+
+// errLocked is returned by lockFile when
+// another process holds the lock
+var errLocked = errors.New("locked by another process")
+
+// resolveConfigPath follows the symlinks of configPath, so the
+// file a symlinked config points to, like the ones of dotfiles
+// repos, is locked and replaced instead of the link
+func resolveConfigPath(configPath string) string {
+	if p, err := filepath.EvalSymlinks(configPath); err == nil {
+		return p
+	}
+	return configPath
+}
+
+// LockFile takes the advisory lock of the file at path, through
+// path+".lock", shared to read it and exclusive to change it. It waits
+// for the other bin processes holding it, and returns the function
+// that releases it.
+func LockFile(path string, exclusive bool) (func(), error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0664)
+	if err != nil {
+		return nil, fmt.Errorf("error locking %s: %w", path, err)
+	}
+	err = lockFile(f, exclusive, false)
+	if errors.Is(err, errLocked) {
+		log.Debugf("Waiting for another bin process to finish with %s", path)
+		err = lockFile(f, exclusive, true)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error locking %s: %w", path, err)
+	}
+	return func() {
+		if err := unlockFile(f); err != nil {
+			log.Debugf("Error unlocking %s: %v", path, err)
+		}
+		f.Close()
+	}, nil
+}
+
+// readConfig reads the config file at configPath and returns it along
+// with its contents. If the file is empty or isn't valid JSON, as a
+// crash while writing it with older versions could leave it, the newest
+// valid backup is returned instead. It returns a nil config if there's
+// no config file nor backups yet.
+func readConfig(configPath string) (*config, []byte, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	c := &config{}
+	var decodeErr error
+	if len(bytes.TrimSpace(data)) > 0 {
+		if decodeErr = json.Unmarshal(data, c); decodeErr == nil {
+			return c, data, nil
+		}
+	}
+
+	for i := 1; i <= keepBackups; i++ {
+		backup := fmt.Sprintf("%s.%d", configPath, i)
+		b, err := os.ReadFile(backup)
+		if err != nil || len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		c := &config{}
+		if err := json.Unmarshal(b, c); err != nil {
+			continue
+		}
+		if decodeErr != nil {
+			log.Warnf("%s isn't valid (%v), using the backup %s", configPath, decodeErr, backup)
+		} else {
+			log.Warnf("%s is empty, using the backup %s", configPath, backup)
+		}
+		return c, data, nil
+	}
+
+	if decodeErr != nil {
+		return nil, nil, fmt.Errorf("error reading %s: %w", configPath, decodeErr)
+	}
+	return nil, data, nil
+}
+
+// save applies change to cfg and to the config file. The file is
+// read again under its lock first, so the changes other bin processes
+// made since it was loaded aren't lost, and replaced atomically keeping
+// the previous versions as backups. Callers must hold mu.
+func save(change func(c *config)) error {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return err
+	}
+	configPath = resolveConfigPath(configPath)
+
+	unlock, err := LockFile(configPath, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	onDisk, current, err := readConfig(configPath)
+	if err != nil {
+		return err
+	}
+	change(&cfg)
+	if onDisk == nil {
+		onDisk = &cfg
+	} else {
+		if onDisk.Bins == nil {
+			onDisk.Bins = map[string]*Binary{}
+		}
+		change(onDisk)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(onDisk); err != nil {
+		return err
+	}
+	if bytes.Equal(buf.Bytes(), current) {
+		return nil
+	}
+	return replaceFile(configPath, buf.Bytes(), current)
+}
+
+// replaceFile atomically replaces the file at path with data, keeping
+// its current contents as the newest backup
+func replaceFile(path string, data, current []byte) error {
+	mode := os.FileMode(0664)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+
+	if len(bytes.TrimSpace(current)) > 0 {
+		for i := keepBackups; i > 1; i-- {
+			err := os.Rename(fmt.Sprintf("%s.%d", path, i-1), fmt.Sprintf("%s.%d", path, i))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.WriteFile(path+".1", current, mode); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func useConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "config.json")
+	if contents != "" {
+		if err := os.WriteFile(p, []byte(contents), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := cfg
+	SetPath(p)
+	t.Cleanup(func() {
+		SetPath("")
+		cfg = old
+	})
+	if err := CheckAndLoad(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func readBins(t *testing.T, p string) []string {
+	t.Helper()
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("%s isn't valid: %v", p, err)
+	}
+	var bins []string
+	for b := range c.Bins {
+		bins = append(bins, b)
+	}
+	return bins
+}
+
+func TestSave(t *testing.T) {
+	p := useConfigFile(t, `{"default_path": "/bin", "bins": {"/bin/a": {"path": "/bin/a"}}}`)
+
+	// another bin process adds a binary after this one loaded the config
+	if err := os.WriteFile(p, []byte(`{"default_path": "/bin", "bins": {"/bin/a": {"path": "/bin/a"}, "/bin/b": {"path": "/bin/b"}}}`), 0664); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpsertBinary(&Binary{Path: "/bin/c"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readBins(t, p); len(got) != 3 {
+		t.Errorf("expected the binaries of both processes, got %q", got)
+	}
+	if err := RemoveBinaries([]string{"/bin/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Bins["/bin/a"]; ok {
+		t.Error("the binary wasn't removed from the loaded config")
+	}
+	if len(readBins(t, p)) != 2 || len(readBins(t, p+".1")) != 3 || len(readBins(t, p+".2")) != 2 {
+		t.Error("unexpected backups")
+	}
+
+	for i := 0; i < keepBackups+2; i++ {
+		if err := UpsertBinary(&Binary{Path: fmt.Sprintf("/bin/d%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	matches, _ := filepath.Glob(p + ".*")
+	if len(matches) != keepBackups+1 {
+		t.Errorf("expected %d backups and the lock file, got %q", keepBackups, matches)
+	}
+	tmps, _ := filepath.Glob(filepath.Join(filepath.Dir(p), ".config.json-*"))
+	if len(tmps) != 0 {
+		t.Errorf("temp files were left behind: %q", tmps)
+	}
+}
+
+func TestLoadBackup(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(p+".1", []byte(`{"default_path": "/bin", "bins": {"/bin/a": {"path": "/bin/a"}}}`), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, broken := range []string{"\n", `{"default_path": "/bi`} {
+		if err := os.WriteFile(p, []byte(broken), 0664); err != nil {
+			t.Fatal(err)
+		}
+		c, _, err := readConfig(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c == nil || c.Bins["/bin/a"] == nil {
+			t.Errorf("%q: the backup wasn't used", broken)
+		}
+	}
+
+	if err := os.Remove(p + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readConfig(p); err == nil {
+		t.Error("expected an error for an invalid config without backups")
+	}
+	if err := os.WriteFile(p, nil, 0664); err != nil {
+		t.Fatal(err)
+	}
+	if c, _, err := readConfig(p); err != nil || c != nil {
+		t.Errorf("an empty config without backups should be a new one, got %v, %v", c, err)
+	}
+}
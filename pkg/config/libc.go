@@ -0,0 +1,92 @@
+package config
+
+import (
+	"debug/elf"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/caarlos0/log"
+)
+
+// Supported values of GetLibc
+const (
+	LibcGlibc = "glibc"
+	LibcMusl  = "musl"
+)
+
+var (
+	libcOnce sync.Once
+	libc     string
+)
+
+// GetLibc returns the C library of the target of the config or the
+// host one, LibcGlibc or LibcMusl, or an empty string if it's not
+// Linux or it can't be detected.
+func GetLibc() string {
+	if target != nil {
+		return target.Libc
+	}
+	libcOnce.Do(func() {
+		if runtime.GOOS != "linux" {
+			return
+		}
+		libc = detectLibc()
+		log.Debugf("Detected libc: %q", libc)
+	})
+	return libc
+}
+
+func detectLibc() string {
+	// the interpreter of the shell is the most reliable hint, Alpine
+	// and friends might have a glibc compat layer installed too
+	if interp, err := elfFileInterpreter("/bin/sh"); err == nil && interp != "" {
+		if l := libcFromInterpreter(interp); l != "" {
+			return l
+		}
+	}
+	if matches, _ := filepath.Glob("/lib/ld-musl-*.so.1"); len(matches) > 0 {
+		return LibcMusl
+	}
+	if matches, _ := filepath.Glob("/lib*/ld-linux*.so.*"); len(matches) > 0 {
+		return LibcGlibc
+	}
+	return ""
+}
+
+// ElfInterpreter returns the dynamic loader requested by f,
+// or an empty string if it's statically linked
+func ElfInterpreter(f *elf.File) (string, error) {
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_INTERP {
+			continue
+		}
+		data := make([]byte, p.Filesz)
+		if _, err := p.ReadAt(data, 0); err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\x00"), nil
+	}
+	return "", nil
+}
+
+// elfFileInterpreter is ElfInterpreter for the ELF file at path
+func elfFileInterpreter(path string) (string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return ElfInterpreter(f)
+}
+
+func libcFromInterpreter(interp string) string {
+	switch base := filepath.Base(interp); {
+	case strings.HasPrefix(base, "ld-musl"):
+		return LibcMusl
+	case strings.HasPrefix(base, "ld-linux"), strings.HasPrefix(base, "ld64.so"), strings.HasPrefix(base, "ld.so"):
+		return LibcGlibc
+	}
+	return ""
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Target is the platform binaries are selected for when
+// it's not the host one, e.g. to fill a container image
+// for another architecture
+type Target struct {
+	OS string `json:"os"`
+	// Arch is a GOARCH or any of its aliases, optionally
+	// with a variant like armv6 or x86_64_v3
+	Arch string `json:"arch"`
+	Libc string `json:"libc,omitempty"`
+
+	goarch string
+	level  int
+}
+
+// knownOS are the GOOS values accepted as targets
+var knownOS = []string{"aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "ios", "linux", "netbsd", "openbsd", "plan9", "solaris", "windows"}
+
+var osAliases = map[string]string{
+	"macos": "darwin",
+	"osx":   "darwin",
+	"win":   "windows",
+}
+
+var (
+	amd64LevelRegex = regexp.MustCompile(`^(?:x86_64|x86-64|amd64)[_-]?v([1-4])$`)
+	armVersionRegex = regexp.MustCompile(`^arm(?:v|_|-)?([5-7])[a-z]*$`)
+)
+
+// ParseTarget validates and normalizes a target, the empty
+// values are the ones of the host
+func ParseTarget(goos, arch, libc string) (*Target, error) {
+	t := &Target{OS: strings.ToLower(goos), Arch: strings.ToLower(arch), Libc: strings.ToLower(libc)}
+
+	if t.OS == "" {
+		t.OS = runtime.GOOS
+	}
+	if o, ok := osAliases[t.OS]; ok {
+		t.OS = o
+	}
+	if !containsString(knownOS, t.OS) {
+		return nil, fmt.Errorf("unknown OS %q, use one of %s", goos, strings.Join(knownOS, ", "))
+	}
+
+	switch {
+	case t.Arch == "":
+		t.Arch = runtime.GOARCH
+		t.goarch, t.level = runtime.GOARCH, hostArchLevel()
+	case amd64LevelRegex.MatchString(t.Arch):
+		t.goarch = "amd64"
+		t.level, _ = strconv.Atoi(amd64LevelRegex.FindStringSubmatch(t.Arch)[1])
+	case armVersionRegex.MatchString(t.Arch):
+		t.goarch = "arm"
+		t.level, _ = strconv.Atoi(armVersionRegex.FindStringSubmatch(t.Arch)[1])
+	case t.Arch == "armhf":
+		t.goarch, t.level = "arm", 7
+	case t.Arch == "armel":
+		t.goarch, t.level = "arm", 5
+	default:
+		for goarch, aliases := range archAliases {
+			if t.Arch == goarch || containsString(aliases, t.Arch) {
+				t.goarch = goarch
+				break
+			}
+		}
+		if t.goarch == "" {
+			return nil, fmt.Errorf("unknown architecture %q", arch)
+		}
+		// without a variant, assume the baseline of the
+		// architecture, or the go default for arm
+		switch t.goarch {
+		case "amd64":
+			t.level = 1
+		case "arm":
+			t.level = 7
+		}
+	}
+
+	switch t.Libc {
+	case "":
+	case "gnu", LibcGlibc:
+		t.Libc = LibcGlibc
+	case LibcMusl:
+	default:
+		return nil, fmt.Errorf("unknown libc %q, use %s or %s", libc, LibcGlibc, LibcMusl)
+	}
+	if t.Libc != "" && t.OS != "linux" {
+		return nil, fmt.Errorf("libc can only be set for linux targets")
+	}
+	return t, nil
+}
+
+func (t *Target) String() string {
+	s := t.OS + "/" + t.Arch
+	if t.Libc != "" {
+		s += " (" + t.Libc + ")"
+	}
+	return s
+}
+
+// Equal checks if both targets select the same binaries
+func (t *Target) Equal(o *Target) bool {
+	return t.OS == o.OS && t.goarch == o.goarch && t.level == o.level && t.Libc == o.Libc
+}
+
+// GetOS returns the names releases use for the target OS
+func (t *Target) GetOS() []string {
+	res := []string{t.OS}
+	if t.OS == "windows" {
+		// Adding win since some repositories release with that as the indicator of a windows binary
+		res = append(res, "win")
+	}
+	return res
+}
+
+// GetArch returns the names releases use for the target architecture
+func (t *Target) GetArch() []string {
+	return append([]string{t.goarch}, archAliases[t.goarch]...)
+}
+
+// GetArchVariants is the GetArchVariants of the target
+func (t *Target) GetArchVariants() map[string]int {
+	return ArchVariants(t.goarch, t.level)
+}
+
+// GetOSSpecificExtensions returns the extensions of
+// the executables that only run on the target OS
+func (t *Target) GetOSSpecificExtensions() []string {
+	switch t.OS {
+	case "linux":
+		return []string{"AppImage"}
+	case "windows":
+		return []string{"exe"}
+	default:
+		return nil
+	}
+}
+
+func (t *Target) GetLibc() string {
+	return t.Libc
+}
+
+// target is the platform binaries are selected for,
+// nil for the host
+var target *Target
+
+// GetTarget returns the platform binaries are
+// selected for, or nil if it's the host
+func GetTarget() *Target {
+	return target
+}
+
+// UseTarget selects binaries for t until bin exits
+// without changing the target of the config
+func UseTarget(t *Target) {
+	target = t
+}
+
+// SetTarget makes t the target of the config
+func SetTarget(t *Target) error {
+	mu.Lock()
+	defer mu.Unlock()
+	target = t
+	return save(func(c *config) { c.Target = t })
+}
+
+// GetOS is the OS binaries are selected for, the one of the
+// target of the config or the running program's one: one of
+// darwin, freebsd, linux, and so on
+func GetOS() []string {
+	if target != nil {
+		return target.GetOS()
+	}
+	return (&Target{OS: runtime.GOOS}).GetOS()
+}
+
+// GetArch is the architecture binaries are selected for, the one
+// of the target of the config or the running program's one: one of
+// 386, amd64, arm, s390x, and so on, followed by the other names
+// releases use for it
+func GetArch() []string {
+	if target != nil {
+		return target.GetArch()
+	}
+	return (&Target{goarch: runtime.GOARCH}).GetArch()
+}
+
+// GetArchVariants returns the names of the variants of the
+// architecture, like armv7 or x86_64_v3, with the score they add.
+// The more specific compatible variants score higher and the ones
+// the CPU can't run, or other architectures with a similar name,
+// have a negative score.
+func GetArchVariants() map[string]int {
+	if target != nil {
+		return target.GetArchVariants()
+	}
+	archVariantsOnce.Do(func() {
+		archVariants = ArchVariants(runtime.GOARCH, hostArchLevel())
+	})
+	return archVariants
+}
+
+// GetOSSpecificExtensions returns the extensions of the
+// executables that only run on the OS of GetOS
+func GetOSSpecificExtensions() []string {
+	if target != nil {
+		return target.GetOSSpecificExtensions()
+	}
+	return (&Target{OS: runtime.GOOS}).GetOSSpecificExtensions()
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package credentials
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cliConfigDir returns the directory where CLIs following the XDG
+// spec store their config. dirEnv, if any, overrides it.
+func cliConfigDir(dirEnv, name string) (string, error) {
+	if dirEnv != "" {
+		if d := os.Getenv(dirEnv); d != "" {
+			return d, nil
+		}
+	}
+	if d := os.Getenv("XDG_CONFIG_HOME"); d != "" {
+		return filepath.Join(d, name), nil
+	}
+	if runtime.GOOS == "windows" {
+		if d := os.Getenv("AppData"); d != "" {
+			return filepath.Join(d, name), nil
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", name), nil
+}
+
+// readYAML decodes file into v. Missing files are not an error.
+func readYAML(file string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, yaml.Unmarshal(data, v)
+}
+
+// fromGH reads the token stored by the GitHub CLI in hosts.yml.
+// Tokens kept in the system keyring by newer gh versions can't be
+// read, use `gh auth token` as a credential helper for those.
+func fromGH(host string) (string, error) {
+	dir, err := cliConfigDir("GH_CONFIG_DIR", "gh")
+	if err != nil {
+		return "", err
+	}
+	hosts := map[string]struct {
+		OAuthToken string `yaml:"oauth_token"`
+	}{}
+	if ok, err := readYAML(filepath.Join(dir, "hosts.yml"), &hosts); !ok || err != nil {
+		return "", err
+	}
+	return hosts[host].OAuthToken, nil
+}
+
+// fromGlab reads the token stored by the GitLab CLI
+func fromGlab(host string) (string, error) {
+	dir, err := cliConfigDir("GLAB_CONFIG_DIR", "glab-cli")
+	if err != nil {
+		return "", err
+	}
+	var cfg struct {
+		Hosts map[string]struct {
+			Token string `yaml:"token"`
+		} `yaml:"hosts"`
+	}
+	if ok, err := readYAML(filepath.Join(dir, "config.yml"), &cfg); !ok || err != nil {
+		return "", err
+	}
+	return cfg.Hosts[host].Token, nil
+}
+
+// fromTea reads the token of the first tea (Gitea/Forgejo CLI)
+// login whose URL matches host
+func fromTea(host string) (string, error) {
+	dir, err := cliConfigDir("", "tea")
+	if err != nil {
+		return "", err
+	}
+	var cfg struct {
+		Logins []struct {
+			URL   string `yaml:"url"`
+			Token string `yaml:"token"`
+		} `yaml:"logins"`
+	}
+	if ok, err := readYAML(filepath.Join(dir, "config.yml"), &cfg); !ok || err != nil {
+		return "", err
+	}
+	for _, l := range cfg.Logins {
+		if u, err := url.Parse(l.URL); err == nil && u.Hostname() == host {
+			return l.Token, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,212 @@
+// Package credentials resolves the token to use for a given host.
+//
+// Sources are checked in the following order and the first one
+// returning a token wins:
+//   - the provider specific environment variables (e.g. GITHUB_TOKEN)
+//   - the token set for the host in bin's config
+//   - the credential helper set for the host (or the global one) in bin's config
+//   - ~/.netrc (or the file set in NETRC)
+//   - the gh, glab and tea CLI config files
+//
+// Every attempt is logged in debug mode so it's easy to find
+// out where a token comes from.
+package credentials
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/caarlos0/log"
+	"github.com/marcosnils/bin/pkg/config"
+)
+
+// source returns the token for host, or an empty string if the
+// source doesn't have one
+type source struct {
+	name   string
+	lookup func(host string) (string, error)
+}
+
+// Token returns the token for host. envVars are checked before any other
+// source in the given order. It returns an empty string when no token
+// is found, in which case requests should be sent anonymously.
+func Token(host string, envVars ...string) string {
+	sources := []source{}
+	for _, e := range envVars {
+		e := e
+		sources = append(sources, source{name: "env " + e, lookup: func(string) (string, error) {
+			return os.Getenv(e), nil
+		}})
+	}
+	sources = append(sources,
+		source{name: "config", lookup: fromConfig},
+		source{name: "credential helper", lookup: fromHelper},
+		source{name: "netrc", lookup: fromNetrc},
+		source{name: "gh config", lookup: fromGH},
+		source{name: "glab config", lookup: fromGlab},
+		source{name: "tea config", lookup: fromTea},
+	)
+
+	for _, s := range sources {
+		token, err := s.lookup(host)
+		if err != nil {
+			log.Debugf("credentials: %s for %s: %v", s.name, host, err)
+			continue
+		}
+		if token != "" {
+			log.Debugf("credentials: using token for %s from %s", host, s.name)
+			return token
+		}
+		log.Debugf("credentials: no token for %s in %s", host, s.name)
+	}
+	log.Debugf("credentials: no token found for %s", host)
+	return ""
+}
+
+func fromConfig(host string) (string, error) {
+	if c := config.Get().Credentials[host]; c != nil {
+		return c.Token, nil
+	}
+	return "", nil
+}
+
+// helperResult is the outcome of running a credential helper
+type helperResult struct {
+	token string
+	err   error
+}
+
+// helperResults caches the results of the credential helpers by helper
+// and host, since a token is looked up for every provider created and
+// helpers might be slow or ask for a password
+var (
+	helperMu      sync.Mutex
+	helperResults = map[[2]string]helperResult{}
+)
+
+// fromHelper runs the credential helper set for host once per process
+func fromHelper(host string) (string, error) {
+	cfg := config.Get()
+	helper := cfg.CredentialHelper
+	if c := cfg.Credentials[host]; c != nil && c.Helper != "" {
+		helper = c.Helper
+	}
+	if helper == "" {
+		return "", nil
+	}
+
+	helperMu.Lock()
+	defer helperMu.Unlock()
+	key := [2]string{helper, host}
+	if r, ok := helperResults[key]; ok {
+		return r.token, r.err
+	}
+	token, err := runHelper(helper, host)
+	helperResults[key] = helperResult{token: token, err: err}
+	return token, err
+}
+
+// runHelper runs a git-credential style helper. Helpers are called
+// with the "get" argument and receive the protocol and host on stdin.
+// The token is read from the password attribute of the output.
+func runHelper(helper, host string) (string, error) {
+	args := strings.Fields(helper)
+	// same convention git uses, "store" runs git-credential-store
+	if !strings.ContainsAny(args[0], `/\`) && !strings.HasPrefix(args[0], "git-credential-") {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			args[0] = "git-credential-" + args[0]
+		}
+	}
+	args = append(args, "get")
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=https\nhost=%s\n\n", host))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("running %s: %w", strings.Join(args, " "), err)
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		if k, v, ok := strings.Cut(s.Text(), "="); ok && k == "password" {
+			return v, nil
+		}
+	}
+	return "", s.Err()
+}
+
+func fromNetrc(host string) (string, error) {
+	file := os.Getenv("NETRC")
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		file = filepath.Join(home, ".netrc")
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			// windows curl convention
+			file = filepath.Join(home, "_netrc")
+		}
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return parseNetrc(string(data), host), nil
+}
+
+// parseNetrc returns the password of the machine entry for host,
+// falling back to the default entry.
+func parseNetrc(data, host string) string {
+	fields := strings.Fields(data)
+	var machine, password, defaultPassword string
+	inDefault := false
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if machine == host && password != "" {
+				return password
+			}
+			inDefault = false
+			machine, password = "", ""
+			if i+1 < len(fields) {
+				machine = fields[i+1]
+				i++
+			}
+		case "default":
+			if machine == host && password != "" {
+				return password
+			}
+			inDefault = true
+			machine, password = "", ""
+		case "password":
+			if i+1 < len(fields) {
+				if inDefault {
+					defaultPassword = fields[i+1]
+				} else {
+					password = fields[i+1]
+				}
+				i++
+			}
+		case "login", "account":
+			i++
+		case "macdef":
+			// macros run until the end of the entry, skip them
+			// along with the rest of the file
+			i = len(fields)
+		}
+	}
+	if machine == host && password != "" {
+		return password
+	}
+	return defaultPassword
+}
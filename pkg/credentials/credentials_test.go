@@ -0,0 +1,88 @@
+package credentials
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/marcosnils/bin/pkg/config"
+)
+
+func TestParseNetrc(t *testing.T) {
+	netrc := `
+machine github.com
+  login user
+  password gh-token
+
+machine gitlab.example.com login other password gl-token
+
+default login anonymous password default-token
+`
+	cases := map[string]string{
+		"github.com":         "gh-token",
+		"gitlab.example.com": "gl-token",
+		"codeberg.org":       "default-token",
+	}
+	for host, want := range cases {
+		if got := parseNetrc(netrc, host); got != want {
+			t.Errorf("parseNetrc(%s) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestTokenOrder(t *testing.T) {
+	dir := t.TempDir()
+	netrc := filepath.Join(dir, "netrc")
+	if err := os.WriteFile(netrc, []byte("machine github.com password netrc-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ghDir := filepath.Join(dir, "gh")
+	if err := os.MkdirAll(ghDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ghDir, "hosts.yml"), []byte("github.com:\n    oauth_token: gh-token\ngithub.corp:\n    oauth_token: ghes-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", netrc)
+	t.Setenv("GH_CONFIG_DIR", ghDir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("TEST_TOKEN", "")
+
+	cfg := config.Get()
+	defer func() { cfg.Credentials, cfg.CredentialHelper = nil, "" }()
+
+	if got := Token("github.corp", "TEST_TOKEN"); got != "ghes-token" {
+		t.Errorf("expected token from gh config, got %q", got)
+	}
+	if got := Token("github.com", "TEST_TOKEN"); got != "netrc-token" {
+		t.Errorf("expected token from netrc, got %q", got)
+	}
+
+	if runtime.GOOS != "windows" {
+		helper := filepath.Join(dir, "git-credential-test")
+		runs := filepath.Join(dir, "runs")
+		if err := os.WriteFile(helper, []byte("#!/bin/sh\ncat > /dev/null\necho run >> "+runs+"\necho username=x\necho password=helper-token\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		cfg.CredentialHelper = helper
+		for i := 0; i < 3; i++ {
+			if got := Token("github.com", "TEST_TOKEN"); got != "helper-token" {
+				t.Errorf("expected token from credential helper, got %q", got)
+			}
+		}
+		if data, _ := os.ReadFile(runs); string(data) != "run\n" {
+			t.Errorf("expected the helper to run once, got %q", data)
+		}
+	}
+
+	cfg.Credentials = map[string]*config.Credential{"github.com": {Token: "config-token"}}
+	if got := Token("github.com", "TEST_TOKEN"); got != "config-token" {
+		t.Errorf("expected token from config, got %q", got)
+	}
+
+	t.Setenv("TEST_TOKEN", "env-token")
+	if got := Token("github.com", "TEST_TOKEN"); got != "env-token" {
+		t.Errorf("expected token from env, got %q", got)
+	}
+}
@@ -1,9 +1,16 @@
 package options
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
 )
 
 type LiteralStringer string
@@ -12,13 +19,151 @@ func (l LiteralStringer) String() string {
 	return string(l)
 }
 
+// interactive is disabled with SetInteractive when
+// nobody can answer the prompts, e.g. in CI
+var interactive = true
+
+// ErrNonInteractive is returned by the prompts
+// when they're disabled with SetInteractive
+var ErrNonInteractive = errors.New("can't prompt in non-interactive mode")
+
+// SetInteractive enables or disables the prompts. When they're disabled
+// Select and SelectCustom fail with an *AmbiguousError instead of
+// prompting if there's more than one option.
+func SetInteractive(enabled bool) {
+	interactive = enabled
+}
+
+// Interactive checks if prompts are enabled
+func Interactive() bool {
+	return interactive
+}
+
+// promptMu serializes the prompts of the
+// binaries processed at once
+var promptMu sync.Mutex
+
+var (
+	// heldMu guards prompting and held
+	heldMu sync.Mutex
+	// prompting is set while a prompt is open
+	prompting bool
+	// held is the output written to the writers of
+	// HoldWhilePrompting while a prompt is open
+	held []heldWrite
+)
+
+type heldWrite struct {
+	w io.Writer
+	p []byte
+}
+
+// LockPrompts waits for other prompts to be answered and returns a
+// function releasing the lock, so the prompts of concurrent tasks
+// don't interleave
+func LockPrompts() func() {
+	promptMu.Lock()
+	heldMu.Lock()
+	prompting = true
+	heldMu.Unlock()
+	return func() {
+		heldMu.Lock()
+		prompting = false
+		for _, h := range held {
+			_, _ = h.w.Write(h.p)
+		}
+		held = nil
+		heldMu.Unlock()
+		promptMu.Unlock()
+	}
+}
+
+// holdingWriter is returned by HoldWhilePrompting
+type holdingWriter struct {
+	w io.Writer
+}
+
+func (h holdingWriter) Write(p []byte) (int, error) {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	if prompting {
+		held = append(held, heldWrite{w: h.w, p: bytes.Clone(p)})
+		return len(p), nil
+	}
+	return h.w.Write(p)
+}
+
+// HoldWhilePrompting returns a writer to w that holds what's written
+// while a prompt is open until it's answered, so the output of other
+// tasks doesn't break the prompt
+func HoldWhilePrompting(w io.Writer) io.Writer {
+	return holdingWriter{w: w}
+}
+
+// IsTerminal checks if f is a terminal
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// AmbiguousError is returned instead of prompting when prompts
+// are disabled and there's more than one option to choose from
+type AmbiguousError struct {
+	Msg        string
+	Candidates []string
+	// Hint tells how to pick one of the candidates
+	// without prompting
+	Hint string
+}
+
+func (e *AmbiguousError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, %s. Candidates:", e.Msg, ErrNonInteractive)
+	for _, c := range e.Candidates {
+		fmt.Fprintf(&b, "\n  - %s", c)
+	}
+	if e.Hint != "" {
+		fmt.Fprintf(&b, "\n%s", e.Hint)
+	}
+	return b.String()
+}
+
+func (e *AmbiguousError) Unwrap() error {
+	return ErrNonInteractive
+}
+
+// NewAmbiguousError returns an *AmbiguousError listing opts
+func NewAmbiguousError(msg string, opts []fmt.Stringer, hint string) *AmbiguousError {
+	candidates := make([]string, 0, len(opts))
+	for _, o := range opts {
+		candidates = append(candidates, o.String())
+	}
+	return &AmbiguousError{Msg: strings.TrimRight(strings.TrimSpace(msg), ":"), Candidates: candidates, Hint: hint}
+}
+
 // Select prompts the user which
 // of the available options is the desired
-// through STDIN and returns the selected one
+// through STDIN and returns the selected one.
+// Terminals get a picker filtering the options
+// as the user types, other inputs a numbered list.
 func Select(msg string, opts []fmt.Stringer) (interface{}, error) {
+	if len(opts) > 1 && interactive {
+		defer LockPrompts()()
+	}
+	return SelectLocked(msg, opts)
+}
+
+// SelectLocked is Select for callers holding LockPrompts, so
+// several prompts are answered without others in between
+func SelectLocked(msg string, opts []fmt.Stringer) (interface{}, error) {
 	if len(opts) == 1 {
 		return opts[0], nil
 	}
+	if !interactive {
+		return nil, NewAmbiguousError(msg, opts, "")
+	}
+	if canPick() {
+		return pick(msg, opts, false)
+	}
 	fmt.Printf("\n%s\n", msg)
 	for i, o := range opts {
 		fmt.Printf("\n [%d] %s", i+1, o)
@@ -47,11 +192,19 @@ func Select(msg string, opts []fmt.Stringer) (interface{}, error) {
 
 // SelectCustom prompts the user which
 // of the available options is the desired
-// through STDIN and returns the selected or a custom one
+// through STDIN and returns the selected or a custom one,
+// using the picker of Select in terminals
 func SelectCustom(msg string, opts []fmt.Stringer) (interface{}, error) {
 	if len(opts) == 1 {
 		return opts[0], nil
 	}
+	if !interactive {
+		return nil, NewAmbiguousError(msg, opts, "")
+	}
+	defer LockPrompts()()
+	if canPick() {
+		return pick(msg, opts, true)
+	}
 	fmt.Printf("\n%s\n", msg)
 	for i, o := range opts {
 		fmt.Printf("\n [%d] %s", i+1, o)
@@ -0,0 +1,24 @@
+package options
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHoldWhilePrompting(t *testing.T) {
+	var buf bytes.Buffer
+	w := HoldWhilePrompting(&buf)
+	_, _ = w.Write([]byte("before "))
+
+	unlock := LockPrompts()
+	_, _ = w.Write([]byte("while prompting "))
+	if buf.String() != "before " {
+		t.Errorf("the output wasn't held while prompting: %q", buf.String())
+	}
+	unlock()
+
+	_, _ = w.Write([]byte("after"))
+	if buf.String() != "before while prompting after" {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
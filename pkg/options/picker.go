@@ -0,0 +1,220 @@
+package options
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// Previewer is implemented by options that show more
+// details when they're highlighted in the picker
+type Previewer interface {
+	Preview() string
+}
+
+// errCancelled is returned when the picker is closed without selecting
+var errCancelled = errors.New("selection cancelled")
+
+// pickerHeight is the number of options shown at once
+const pickerHeight = 10
+
+// picker is a type-to-filter list navigated with the arrow keys
+type picker struct {
+	msg  string
+	opts []fmt.Stringer
+	// custom accepts the query as the value when it
+	// doesn't match any option, see SelectCustom
+	custom bool
+
+	query    []rune
+	filtered []int
+	cursor   int
+	offset   int
+	// lines is the height of the last render, so
+	// it can be cleared before rendering again
+	lines int
+}
+
+func newPicker(msg string, opts []fmt.Stringer, custom bool) *picker {
+	p := &picker{msg: msg, opts: opts, custom: custom}
+	p.filter()
+	return p
+}
+
+// canPick checks if the picker can be used, which
+// needs both stdin and stdout to be terminals
+func canPick() bool {
+	return IsTerminal(os.Stdin) && IsTerminal(os.Stdout)
+}
+
+// pick runs the picker in the terminal
+func pick(msg string, opts []fmt.Stringer, custom bool) (interface{}, error) {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+	return newPicker(msg, opts, custom).run(os.Stdin, os.Stdout)
+}
+
+// run reads keys from in until an option is selected, rendering the
+// picker to out. in is expected to be a terminal in raw mode.
+func (p *picker) run(in io.Reader, out io.Writer) (interface{}, error) {
+	r := bufio.NewReader(in)
+	p.render(out)
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil {
+			p.clear(out)
+			return nil, err
+		}
+		switch c {
+		case '\r', '\n':
+			if choice := p.selected(); choice != nil {
+				p.clear(out)
+				fmt.Fprintf(out, "%s %s\r\n", p.msg, choice)
+				return choice, nil
+			}
+		case 3, 4: // ctrl+c, ctrl+d
+			p.clear(out)
+			return nil, errCancelled
+		case 127, 8: // backspace
+			if len(p.query) > 0 {
+				p.query = p.query[:len(p.query)-1]
+				p.filter()
+			}
+		case 21: // ctrl+u
+			p.query = nil
+			p.filter()
+		case 16: // ctrl+p
+			p.move(-1)
+		case 14: // ctrl+n
+			p.move(1)
+		case 27: // escape sequences
+			// a lone escape key closes the picker, the arrow
+			// keys send the whole sequence at once
+			if r.Buffered() == 0 {
+				p.clear(out)
+				return nil, errCancelled
+			}
+			seq := make([]byte, 2)
+			if _, err := io.ReadFull(r, seq); err != nil {
+				p.clear(out)
+				return nil, err
+			}
+			switch string(seq) {
+			case "[A", "OA":
+				p.move(-1)
+			case "[B", "OB":
+				p.move(1)
+			}
+		default:
+			if unicode.IsPrint(c) {
+				p.query = append(p.query, c)
+				p.filter()
+			}
+		}
+		p.render(out)
+	}
+}
+
+// selected returns the highlighted option, the query for custom
+// pickers without matches, or nil if there's nothing to select
+func (p *picker) selected() fmt.Stringer {
+	if len(p.filtered) > 0 {
+		return p.opts[p.filtered[p.cursor]]
+	}
+	if p.custom && len(p.query) > 0 {
+		return LiteralStringer(string(p.query))
+	}
+	return nil
+}
+
+// filter keeps the options containing the characters
+// of the query in the same order, ignoring case
+func (p *picker) filter() {
+	p.filtered = p.filtered[:0]
+	for i, o := range p.opts {
+		if fuzzyMatch(string(p.query), o.String()) {
+			p.filtered = append(p.filtered, i)
+		}
+	}
+	p.cursor, p.offset = 0, 0
+}
+
+func fuzzyMatch(query, s string) bool {
+	s = strings.ToLower(s)
+	for _, q := range strings.ToLower(query) {
+		i := strings.IndexRune(s, q)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(q):]
+	}
+	return true
+}
+
+// move moves the cursor keeping it visible
+func (p *picker) move(delta int) {
+	if len(p.filtered) == 0 {
+		return
+	}
+	p.cursor = (p.cursor + delta + len(p.filtered)) % len(p.filtered)
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	} else if p.cursor >= p.offset+pickerHeight {
+		p.offset = p.cursor - pickerHeight + 1
+	}
+}
+
+func (p *picker) render(out io.Writer) {
+	p.clear(out)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (type to filter, arrows to move, enter to select)\r\n", p.msg)
+	fmt.Fprintf(&b, "> %s\r\n", string(p.query))
+	lines := 2
+
+	end := min(p.offset+pickerHeight, len(p.filtered))
+	for i := p.offset; i < end; i++ {
+		marker := "  "
+		if i == p.cursor {
+			marker = "\x1b[7m>"
+		}
+		fmt.Fprintf(&b, "%s %s\x1b[0m\r\n", marker, p.opts[p.filtered[i]])
+		lines++
+	}
+	switch {
+	case len(p.filtered) == 0 && p.custom && len(p.query) > 0:
+		fmt.Fprintf(&b, "  press enter to use %q\r\n", string(p.query))
+		lines++
+	case len(p.filtered) == 0:
+		b.WriteString("  no matches\r\n")
+		lines++
+	default:
+		preview := ""
+		if pv, ok := p.opts[p.filtered[p.cursor]].(Previewer); ok {
+			preview = pv.Preview()
+		}
+		fmt.Fprintf(&b, "\x1b[2m  %d/%d  %s\x1b[0m\r\n", len(p.filtered), len(p.opts), preview)
+		lines++
+	}
+
+	io.WriteString(out, b.String())
+	p.lines = lines
+}
+
+// clear erases the last render
+func (p *picker) clear(out io.Writer) {
+	if p.lines > 0 {
+		fmt.Fprintf(out, "\x1b[%dA\r\x1b[J", p.lines)
+		p.lines = 0
+	}
+}
@@ -0,0 +1,64 @@
+package options
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+type previewStringer string
+
+func (p previewStringer) String() string  { return string(p) }
+func (p previewStringer) Preview() string { return "preview of " + string(p) }
+
+func TestPicker(t *testing.T) {
+	opts := []fmt.Stringer{
+		LiteralStringer("tool-linux-amd64.tar.gz"),
+		LiteralStringer("tool-linux-arm64.tar.gz"),
+		LiteralStringer("tool-darwin-arm64.tar.gz"),
+		previewStringer("tool-windows-amd64.zip"),
+	}
+	cases := []struct {
+		name   string
+		keys   string
+		custom bool
+		want   string
+	}{
+		{"enter selects the first option", "\r", false, "tool-linux-amd64.tar.gz"},
+		{"arrows move", "\x1b[B\x1b[B\r", false, "tool-darwin-arm64.tar.gz"},
+		{"up wraps around", "\x1b[A\r", false, "tool-windows-amd64.zip"},
+		{"fuzzy filter", "darm\r", false, "tool-darwin-arm64.tar.gz"},
+		{"filter then move", "arm64\x1b[B\r", false, "tool-darwin-arm64.tar.gz"},
+		{"backspace", "zipx\x7f\r", false, "tool-windows-amd64.zip"},
+		{"custom value", "/opt/bin\r", true, "/opt/bin"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := newPicker("Select an asset", opts, c.custom).run(strings.NewReader(c.keys), io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.(fmt.Stringer).String() != c.want {
+				t.Errorf("got %s, want %s", got, c.want)
+			}
+		})
+	}
+
+	// enter without matches does nothing
+	if _, err := newPicker("Select an asset", opts, false).run(strings.NewReader("xyz\r"), io.Discard); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+	if _, err := newPicker("Select an asset", opts, false).run(strings.NewReader("\x03"), io.Discard); err != errCancelled {
+		t.Errorf("expected a cancelled selection, got %v", err)
+	}
+
+	var out bytes.Buffer
+	if _, err := newPicker("Select an asset", opts, false).run(strings.NewReader("zip\r"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "preview of tool-windows-amd64.zip") {
+		t.Errorf("the preview wasn't rendered: %q", out.String())
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"io"
 	"os"
 	"strings"
+
+	"github.com/marcosnils/bin/pkg/options"
 )
 
 var stdin io.Reader = os.Stdin
@@ -14,6 +16,10 @@ var stdin io.Reader = os.Stdin
 // for the given message and waits for the
 // users input.
 func Confirm(message string) error {
+	if !options.Interactive() {
+		return fmt.Errorf("%q needs confirmation: %w", message, options.ErrNonInteractive)
+	}
+	defer options.LockPrompts()()
 	fmt.Printf("\n%s [Y/n] ", message)
 	reader := bufio.NewReader(stdin)
 	var response string
@@ -2,7 +2,10 @@ package prompt
 
 import (
 	"bytes"
+	"errors"
 	"testing"
+
+	"github.com/marcosnils/bin/pkg/options"
 )
 
 func TestConfirm(t *testing.T) {
@@ -30,4 +33,13 @@ func TestConfirm(t *testing.T) {
 			t.Fail()
 		}
 	})
+
+	t.Run("Prompts are disabled", func(t *testing.T) {
+		options.SetInteractive(false)
+		defer options.SetInteractive(true)
+		stdin = bytes.NewReader([]byte("y\n"))
+		if err := Confirm("Do you want to continue?"); !errors.Is(err, options.ErrNonInteractive) {
+			t.Fatalf("expected a non-interactive error, got %v", err)
+		}
+	})
 }
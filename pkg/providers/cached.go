@@ -0,0 +1,60 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/marcosnils/bin/pkg/assets"
+	"github.com/marcosnils/bin/pkg/cache"
+)
+
+// ErrOffline is returned by the operations that
+// need the network when working offline
+var ErrOffline = errors.New("not available offline")
+
+// cached installs binaries from the release assets in the download
+// cache, without any network access. It stands in for the provider
+// id the binary was installed with.
+type cached struct {
+	id     string
+	digest string
+}
+
+// NewCached returns a provider that fetches the
+// asset with digest from the download cache
+func NewCached(id, digest string) Provider {
+	return &cached{id: id, digest: digest}
+}
+
+func (c *cached) GetID() string {
+	return c.id
+}
+
+func (c *cached) Fetch(opts *FetchOpts) (*File, error) {
+	if c.digest == "" {
+		return nil, fmt.Errorf("the release asset isn't recorded, it has to be downloaded again: %w", cache.ErrNotCached)
+	}
+	e, path, err := cache.Get(c.digest)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck, PackageName: opts.PackageName, NamePattern: opts.NamePattern, Files: opts.Files, Extras: opts.Extras, ScoringRules: opts.ScoringRules})
+	outFile, err := f.ProcessReader(e.Name, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{Data: outFile.Source, Name: outFile.Name, Version: opts.Version, PackagePath: outFile.PackagePath, Asset: e.Name, Digest: c.digest, Group: groupFiles(outFile.Group, opts.Version), Extras: outFile.Extras, PickedAsset: outFile.PickedAsset, PickedFile: outFile.PickedFile}, nil
+}
+
+func (c *cached) GetLatestVersion() (string, string, error) {
+	return "", "", fmt.Errorf("checking the latest version is %w", ErrOffline)
+}
@@ -4,12 +4,13 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 
 	"code.gitea.io/sdk/gitea"
 	"github.com/caarlos0/log"
 	"github.com/marcosnils/bin/pkg/assets"
+	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/credentials"
 )
 
 type codeberg struct {
@@ -48,9 +49,9 @@ func (c *codeberg) Fetch(opts *FetchOpts) (*File, error) {
 
 	candidates := []*assets.Asset{}
 	for _, a := range release.Attachments {
-		candidates = append(candidates, &assets.Asset{Name: a.Name, URL: a.DownloadURL})
+		candidates = append(candidates, &assets.Asset{Name: a.Name, URL: a.DownloadURL, Size: a.Size})
 	}
-	f := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck, PackageName: opts.PackageName, NamePattern: opts.NamePattern})
+	f := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck, PackageName: opts.PackageName, NamePattern: opts.NamePattern, Files: opts.Files, Extras: opts.Extras, ScoringRules: opts.ScoringRules})
 
 	gf, err := f.FilterAssets(c.repo, candidates)
 	if err != nil {
@@ -72,7 +73,7 @@ func (c *codeberg) Fetch(opts *FetchOpts) (*File, error) {
 	// TODO calculate file hash. Not sure if we can / should do it here
 	// since we don't want to read the file unnecesarily. Additionally, sometimes
 	// releases have .sha256 files, so it'd be nice to check for those also
-	file := &File{Data: outFile.Source, Name: outFile.Name, Version: version, PackagePath: outFile.PackagePath}
+	file := &File{Data: outFile.Source, Name: outFile.Name, Version: version, PackagePath: outFile.PackagePath, Asset: gf.Name, Digest: outFile.Digest, Group: groupFiles(outFile.Group, version), Extras: outFile.Extras, PickedAsset: outFile.PickedAsset, PickedFile: outFile.PickedFile}
 
 	return file, nil
 }
@@ -114,10 +115,10 @@ func newCodeberg(u *url.URL) (Provider, error) {
 
 	}
 
-	token := os.Getenv("CODEBERG_TOKEN")
+	token := credentials.Token(u.Hostname(), "CODEBERG_TOKEN")
 
 	// Codeberg uses Gitea/Forgejo, use the Gitea SDK
-	baseURL := fmt.Sprintf("https://%s/", u.Hostname())
+	baseURL := config.RewriteURL(fmt.Sprintf("https://%s/", u.Hostname()))
 
 	var client *gitea.Client
 	var err error
@@ -0,0 +1,231 @@
+package providers
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/caarlos0/log"
+	"github.com/hashicorp/go-version"
+	"github.com/marcosnils/bin/pkg/assets"
+)
+
+// fileVersion matches the version embedded in archive names
+// like tool_1.2.3_linux_amd64.tar.gz or tool-v2.0.zip
+var fileVersion = regexp.MustCompile(`v?\d+(?:\.\d+)+`)
+
+// file installs binaries from the local filesystem. The URL can either
+// point to a specific file or to a directory. In the latter case, bin
+// looks for the file with the highest version in its name so updates
+// can pick up newer archives dropped into the directory.
+type file struct {
+	url  string
+	path string
+	dir  bool
+}
+
+type localFile struct {
+	path    string
+	version string
+}
+
+func (f *file) GetID() string {
+	return "file"
+}
+
+func (f *file) Fetch(opts *FetchOpts) (*File, error) {
+	var candidates []localFile
+	v := opts.Version
+	if f.dir {
+		files, err := f.list()
+		if err != nil {
+			return nil, err
+		}
+		if v == "" {
+			if v, err = latestLocalVersion(files); err != nil {
+				return nil, fmt.Errorf("%w in %s", err, f.path)
+			}
+		}
+		for _, lf := range files {
+			if lf.version == v {
+				candidates = append(candidates, lf)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("no files with version %s found in %s", v, f.path)
+		}
+	} else {
+		if v == "" {
+			v = versionFromName(filepath.Base(f.path))
+		}
+		if v == "" {
+			return nil, fmt.Errorf("can't determine the version of %s from its name, use the --version flag", f.path)
+		}
+		candidates = []localFile{{path: f.path, version: v}}
+	}
+
+	as := make([]*assets.Asset, 0, len(candidates))
+	paths := map[string]string{}
+	for _, c := range candidates {
+		name := filepath.Base(c.path)
+		a := &assets.Asset{Name: name, URL: fileURL(c.path)}
+		if fi, err := os.Stat(c.path); err == nil {
+			a.Size = fi.Size()
+		}
+		as = append(as, a)
+		paths[name] = c.path
+	}
+
+	filter := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck, PackageName: opts.PackageName, NamePattern: opts.NamePattern, Files: opts.Files, Extras: opts.Extras, ScoringRules: opts.ScoringRules})
+	fa, err := filter.FilterAssets(strings.TrimSuffix(filepath.Base(f.path), filepath.Ext(f.path)), as)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Reading %s", paths[fa.Name])
+	r, err := os.Open(paths[fa.Name])
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	outFile, err := filter.ProcessReader(fa.Name, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{Data: outFile.Source, Name: outFile.Name, Version: v, PackagePath: outFile.PackagePath, Asset: fa.Name, Group: groupFiles(outFile.Group, v), Extras: outFile.Extras, PickedAsset: outFile.PickedAsset, PickedFile: outFile.PickedFile}, nil
+}
+
+// GetLatestVersion returns the highest version found in the directory. For
+// file URLs, sibling files whose names only differ in the version are
+// considered, and the URL of the newest one is returned.
+func (f *file) GetLatestVersion() (string, string, error) {
+	files, err := f.list()
+	if err != nil {
+		return "", "", err
+	}
+
+	if !f.dir {
+		current := versionFromName(filepath.Base(f.path))
+		if current == "" {
+			return "", "", fmt.Errorf("can't determine the version of %s from its name", f.path)
+		}
+		pattern := siblingPattern(filepath.Base(f.path))
+		var siblings []localFile
+		for _, lf := range files {
+			if pattern.MatchString(filepath.Base(lf.path)) {
+				siblings = append(siblings, lf)
+			}
+		}
+		files = siblings
+	}
+
+	v, err := latestLocalVersion(files)
+	if err != nil {
+		return "", "", fmt.Errorf("%w in %s", err, f.path)
+	}
+
+	if f.dir {
+		return v, f.url, nil
+	}
+	for _, lf := range files {
+		if lf.version == v {
+			return v, fileURL(lf.path), nil
+		}
+	}
+	return v, f.url, nil
+}
+
+// list returns the versioned files in the watched directory
+func (f *file) list() ([]localFile, error) {
+	dir := f.path
+	if !f.dir {
+		dir = filepath.Dir(f.path)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []localFile
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		v := versionFromName(e.Name())
+		if v == "" {
+			log.Debugf("Skipping %s, it doesn't contain a version", e.Name())
+			continue
+		}
+		files = append(files, localFile{path: filepath.Join(dir, e.Name()), version: v})
+	}
+	return files, nil
+}
+
+// versionFromName returns the first version found in name
+func versionFromName(name string) string {
+	return fileVersion.FindString(name)
+}
+
+// siblingPattern returns a regexp that matches name with
+// any other version in place of its current one
+func siblingPattern(name string) *regexp.Regexp {
+	loc := fileVersion.FindStringIndex(name)
+	return regexp.MustCompile("^" + regexp.QuoteMeta(name[:loc[0]]) + fileVersion.String() + regexp.QuoteMeta(name[loc[1]:]) + "$")
+}
+
+// latestLocalVersion returns the highest version of the given files
+func latestLocalVersion(files []localFile) (string, error) {
+	var vs version.Collection
+	original := map[*version.Version]string{}
+	for _, lf := range files {
+		sv, err := version.NewVersion(lf.version)
+		if err != nil {
+			continue
+		}
+		vs = append(vs, sv)
+		original[sv] = lf.version
+	}
+	if len(vs) == 0 {
+		return "", fmt.Errorf("no versioned files found")
+	}
+	sort.Sort(vs)
+	return original[vs[len(vs)-1]], nil
+}
+
+func fileURL(p string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(p)}).String()
+}
+
+func newFile(u string) (Provider, error) {
+	p := u
+	if strings.HasPrefix(u, "file://") {
+		pu, err := url.Parse(u)
+		if err != nil {
+			return nil, err
+		}
+		p = pu.Path
+		// file:///C:/tools is parsed as /C:/tools
+		if runtime.GOOS == "windows" {
+			p = strings.TrimPrefix(p, "/")
+		}
+	}
+	p = filepath.FromSlash(p)
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &file{url: fileURL(abs), path: abs, dir: fi.IsDir()}, nil
+}
@@ -0,0 +1,84 @@
+package providers
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"tool_1.2.0_linux_amd64":  "1.2.0",
+		"tool_1.10.0_linux_amd64": "1.10.0",
+		"tool_1.9.0_linux_amd64":  "1.9.0",
+		"README":                  "readme",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("file URL picks newer siblings", func(t *testing.T) {
+		p, err := New("file://"+filepath.ToSlash(filepath.Join(dir, "tool_1.2.0_linux_amd64")), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, u, err := p.GetLatestVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != "1.10.0" || filepath.Base(u) != "tool_1.10.0_linux_amd64" {
+			t.Errorf("unexpected latest version %s (%s)", v, u)
+		}
+	})
+
+	t.Run("directory fetches the latest version", func(t *testing.T) {
+		p, err := New(dir, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := p.Fetch(&FetchOpts{NamePattern: "tool_*"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(f.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Version != "1.10.0" || string(data) != "1.10.0" {
+			t.Errorf("unexpected file %s@%s: %q", f.Name, f.Version, data)
+		}
+	})
+
+	t.Run("relative paths are local files", func(t *testing.T) {
+		t.Chdir(dir)
+		if got := LocalPath("./tool_1.9.0_linux_amd64"); got != filepath.Join(dir, "tool_1.9.0_linux_amd64") {
+			t.Errorf("unexpected path %s", got)
+		}
+		if got := LocalPath("github.com/owner/tool"); got != "github.com/owner/tool" {
+			t.Errorf("unexpected path %s", got)
+		}
+		p, err := New("./tool_1.9.0_linux_amd64", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.GetID() != "file" {
+			t.Errorf("expected the file provider, got %s", p.GetID())
+		}
+	})
+}
+
+func TestVersionFromName(t *testing.T) {
+	cases := map[string]string{
+		"tool_1.2.3_linux_amd64.tar.gz": "1.2.3",
+		"tool-v2.0-x86_64.zip":          "v2.0",
+		"tool_linux_amd64":              "",
+	}
+	for in, want := range cases {
+		if got := versionFromName(in); got != want {
+			t.Errorf("versionFromName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -2,16 +2,21 @@ package providers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/log"
 	"github.com/google/go-github/v31/github"
 	"github.com/marcosnils/bin/pkg/assets"
+	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/credentials"
 	"github.com/marcosnils/bin/pkg/httpclient"
 	"golang.org/x/oauth2"
 )
@@ -45,20 +50,20 @@ func (g *gitHub) Fetch(opts *FetchOpts) (*File, error) {
 	} else {
 		log.Infof("Getting latest release for %s/%s", g.owner, g.repo)
 		release, resp, err = g.client.Repositories.GetLatestRelease(context.TODO(), g.owner, g.repo)
-		if resp.StatusCode == http.StatusNotFound {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
 			err = fmt.Errorf("repository %s/%s does not have releases", g.owner, g.repo)
 		}
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, g.wrapError(err)
 	}
 
 	candidates := []*assets.Asset{}
 	for _, a := range release.Assets {
-		candidates = append(candidates, &assets.Asset{Name: a.GetName(), URL: a.GetURL()})
+		candidates = append(candidates, &assets.Asset{Name: a.GetName(), URL: a.GetURL(), Size: int64(a.GetSize())})
 	}
-	f := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck, PackageName: opts.PackageName, NamePattern: opts.NamePattern})
+	f := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck, PackageName: opts.PackageName, NamePattern: opts.NamePattern, Files: opts.Files, Extras: opts.Extras, ScoringRules: opts.ScoringRules})
 
 	gf, err := f.FilterAssets(g.repo, candidates)
 	if err != nil {
@@ -80,7 +85,7 @@ func (g *gitHub) Fetch(opts *FetchOpts) (*File, error) {
 	// TODO calculate file hash. Not sure if we can / should do it here
 	// since we don't want to read the file unnecessarily. Additionally, sometimes
 	// releases have .sha256 files, so it'd be nice to check for those also
-	file := &File{Data: outFile.Source, Name: outFile.Name, Version: version, PackagePath: outFile.PackagePath}
+	file := &File{Data: outFile.Source, Name: outFile.Name, Version: version, PackagePath: outFile.PackagePath, Asset: gf.Name, Digest: outFile.Digest, Group: groupFiles(outFile.Group, version), Extras: outFile.Extras, PickedAsset: outFile.PickedAsset, PickedFile: outFile.PickedFile}
 
 	return file, nil
 }
@@ -92,7 +97,7 @@ func (g *gitHub) GetLatestVersion() (string, string, error) {
 		log.Debugf("Getting latest release matching %q for %s/%s", g.filter, g.owner, g.repo)
 		release, err := g.findLatestMatchingRelease()
 		if err != nil {
-			return "", "", err
+			return "", "", g.wrapError(err)
 		}
 		return release.GetTagName(), release.GetHTMLURL(), nil
 	}
@@ -100,7 +105,7 @@ func (g *gitHub) GetLatestVersion() (string, string, error) {
 	log.Debugf("Getting latest release for %s/%s", g.owner, g.repo)
 	release, _, err := g.client.Repositories.GetLatestRelease(context.TODO(), g.owner, g.repo)
 	if err != nil {
-		return "", "", err
+		return "", "", g.wrapError(err)
 	}
 
 	return release.GetTagName(), release.GetHTMLURL(), nil
@@ -133,10 +138,101 @@ func (g *gitHub) findLatestMatchingRelease() (*github.RepositoryRelease, error)
 	return nil, fmt.Errorf("no release matching %q found for %s/%s", g.filter, g.owner, g.repo)
 }
 
+// wrapError converts the go-github rate limit errors to RateLimitError
+// so callers can handle them the same way for every host
+func (g *gitHub) wrapError(err error) error {
+	var rle *github.RateLimitError
+	if errors.As(err, &rle) {
+		return &RateLimitError{Host: g.url.Hostname(), Limit: rle.Rate.Limit, Remaining: rle.Rate.Remaining, Reset: rle.Rate.Reset.Time, Err: err}
+	}
+	var are *github.AbuseRateLimitError
+	if errors.As(err, &are) {
+		reset := time.Now()
+		if are.RetryAfter != nil {
+			reset = reset.Add(*are.RetryAfter)
+		}
+		return &RateLimitError{Host: g.url.Hostname(), Reset: reset, Err: err}
+	}
+	return err
+}
+
 func (g *gitHub) GetID() string {
 	return "github"
 }
 
+// githubEnterpriseHost returns the API and upload URLs for host, or nil if
+// it's github.com. Hosts are looked up in the github_hosts config and in
+// the GHES_BASE_URL and GHES_UPLOAD_URL environment variables. Unknown
+// hosts default to the standard GHES /api/v3 and /api/uploads paths.
+func githubEnterpriseHost(host string) *config.GitHubHost {
+	if host == "github.com" || host == "www.github.com" {
+		return nil
+	}
+	if gbu, guu := os.Getenv("GHES_BASE_URL"), os.Getenv("GHES_UPLOAD_URL"); len(gbu) > 0 && len(guu) > 0 && isGHESEnvHost(host) && config.Get().GitHubHosts[host] == nil {
+		return &config.GitHubHost{APIURL: gbu, UploadURL: guu}
+	}
+	h := config.GitHubHost{}
+	if c := config.Get().GitHubHosts[host]; c != nil {
+		h = *c
+	}
+	if h.APIURL == "" {
+		h.APIURL = fmt.Sprintf("https://%s/api/v3/", host)
+	}
+	if h.UploadURL == "" {
+		h.UploadURL = fmt.Sprintf("https://%s/api/uploads/", host)
+	}
+	return &h
+}
+
+// isGitHubEnterpriseHost reports if host was explicitly configured as a
+// GHES instance, either in the config or through GHES_BASE_URL
+func isGitHubEnterpriseHost(host string) bool {
+	return config.Get().GitHubHosts[host] != nil || isGHESEnvHost(host)
+}
+
+// isGHESEnvHost reports if host is the one set in GHES_BASE_URL
+func isGHESEnvHost(host string) bool {
+	gbu, err := url.Parse(os.Getenv("GHES_BASE_URL"))
+	return err == nil && gbu.Hostname() != "" && gbu.Hostname() == host
+}
+
+// parseGitHubEndpoint parses a GitHub API endpoint making sure it has a
+// trailing slash, as required by the client to resolve relative paths
+func parseGitHubEndpoint(endpoint string) (*url.URL, error) {
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+	return url.Parse(endpoint)
+}
+
+// githubTokenEnvVars returns the environment variables holding the
+// token for host, the most specific first
+func githubTokenEnvVars(host string) []string {
+	envVars := []string{fmt.Sprintf("GITHUB_TOKEN_%s", strings.ReplaceAll(host, `.`, "_"))}
+	if host == "github.com" || host == "www.github.com" {
+		return append(envVars, "GITHUB_AUTH_TOKEN", "GITHUB_TOKEN")
+	}
+	if isGHESEnvHost(host) {
+		envVars = append(envVars, "GHES_AUTH_TOKEN")
+	}
+	return envVars
+}
+
+// rewriteGitHubClientURLs applies the configured URL rewrites
+// to the API and upload base URLs of the client
+func rewriteGitHubClientURLs(client *github.Client) error {
+	baseURL, err := url.Parse(config.RewriteURL(client.BaseURL.String()))
+	if err != nil {
+		return fmt.Errorf("invalid rewritten GitHub API URL: %w", err)
+	}
+	uploadURL, err := url.Parse(config.RewriteURL(client.UploadURL.String()))
+	if err != nil {
+		return fmt.Errorf("invalid rewritten GitHub upload URL: %w", err)
+	}
+	client.BaseURL, client.UploadURL = baseURL, uploadURL
+	return nil
+}
+
 func newGitHub(u *url.URL) (Provider, error) {
 	s := strings.Split(u.Path, "/")
 	if len(s) < 3 {
@@ -168,39 +264,38 @@ func newGitHub(u *url.URL) (Provider, error) {
 		u.RawQuery = q.Encode()
 	}
 
-	token := os.Getenv("GITHUB_AUTH_TOKEN")
-	if len(token) == 0 {
-		token = os.Getenv("GITHUB_TOKEN")
-	}
-
-	// GHES client
-	gbu := os.Getenv("GHES_BASE_URL")
-	guu := os.Getenv("GHES_UPLOAD_URL")
-	gau := os.Getenv("GHES_AUTH_TOKEN")
+	host := u.Hostname()
+	token := credentials.Token(host, githubTokenEnvVars(host)...)
 
 	oauthCtx := context.WithValue(context.Background(), oauth2.HTTPClient, httpclient.Client)
 
-	var tc *http.Client
-
-	if len(gbu) > 0 && len(guu) > 0 && len(gau) > 0 {
-		tc = oauth2.NewClient(oauthCtx, oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: gau},
-		))
-	} else if token != "" {
-		tc = oauth2.NewClient(oauthCtx, oauth2.StaticTokenSource(
+	transport := httpclient.Client.Transport
+	if token != "" {
+		transport = oauth2.NewClient(oauthCtx, oauth2.StaticTokenSource(
 			&oauth2.Token{AccessToken: token},
-		))
+		)).Transport
 	}
 
-	var client *github.Client
-	var err error
+	var cacheDir string
+	if d, err := config.GetCacheDir(); err == nil {
+		cacheDir = filepath.Join(d, "github")
+	}
+	tc := &http.Client{Transport: &githubTransport{base: transport, token: token, cacheDir: cacheDir}}
 
-	if len(gbu) > 0 && len(guu) > 0 && len(gau) > 0 {
-		if client, err = github.NewEnterpriseClient(gbu, guu, tc); err != nil {
+	client := github.NewClient(tc)
+	if ghes := githubEnterpriseHost(host); ghes != nil {
+		log.Debugf("Using GitHub Enterprise Server API %s for %s", ghes.APIURL, host)
+		var err error
+		if client.BaseURL, err = parseGitHubEndpoint(ghes.APIURL); err != nil {
 			return nil, fmt.Errorf("error initializing GHES client %v", err)
 		}
-	} else {
-		client = github.NewClient(tc)
+		if client.UploadURL, err = parseGitHubEndpoint(ghes.UploadURL); err != nil {
+			return nil, fmt.Errorf("error initializing GHES client %v", err)
+		}
+	}
+
+	if err := rewriteGitHubClientURLs(client); err != nil {
+		return nil, err
 	}
 
 	return &gitHub{url: u, client: client, owner: s[1], repo: s[2], tag: tag, token: token, filter: filter}, nil
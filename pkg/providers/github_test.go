@@ -0,0 +1,53 @@
+package providers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/marcosnils/bin/pkg/config"
+)
+
+func TestNewGitHubHosts(t *testing.T) {
+	cfg := config.Get()
+	cfg.GitHubHosts = map[string]*config.GitHubHost{
+		"git.corp.com":     {APIURL: "https://git.corp.com/custom/api/", UploadURL: "https://git.corp.com/custom/uploads/"},
+		"github.other.com": {},
+	}
+	defer func() { cfg.GitHubHosts = nil }()
+	t.Setenv("GHES_BASE_URL", "https://ghes.example.com/api/v3/")
+	t.Setenv("GHES_UPLOAD_URL", "https://ghes.example.com/api/uploads/")
+
+	cases := []struct {
+		in      string
+		baseURL string
+	}{
+		{"https://github.com/marcosnils/bin", "https://api.github.com/"},
+		{"https://git.corp.com/team/tool", "https://git.corp.com/custom/api/"},
+		{"https://ghes.example.com/team/tool", "https://ghes.example.com/api/v3/"},
+		{"https://github.other.com/team/tool", "https://github.other.com/api/v3/"},
+	}
+
+	for _, c := range cases {
+		p, err := New(c.in, "")
+		if err != nil {
+			t.Fatalf("%s: %v", c.in, err)
+		}
+		gh, ok := p.(*gitHub)
+		if !ok {
+			t.Fatalf("%s: expected github provider, got %s", c.in, p.GetID())
+		}
+		if got := gh.client.BaseURL.String(); got != c.baseURL {
+			t.Errorf("%s: expected API URL %s, got %s", c.in, c.baseURL, got)
+		}
+	}
+
+	// hosts that aren't configured but look like GitHub still are
+	if p, err := New("https://github.internal/team/tool", ""); err != nil || p.GetID() != "github" {
+		t.Errorf("github.internal should use the github provider, got %v", err)
+	}
+
+	u, _ := url.Parse("https://ghes.example.com/team/tool")
+	if envs := githubTokenEnvVars(u.Hostname()); envs[len(envs)-1] != "GHES_AUTH_TOKEN" {
+		t.Errorf("expected GHES_AUTH_TOKEN for the GHES_BASE_URL host, got %v", envs)
+	}
+}
@@ -0,0 +1,208 @@
+package providers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/log"
+)
+
+const (
+	// maxRateLimitRetries is the number of times a request is retried
+	// after hitting a rate limit before giving up
+	maxRateLimitRetries = 3
+	// secondaryRateLimitWait is the initial wait for secondary rate
+	// limits without Retry-After, as recommended by GitHub
+	secondaryRateLimitWait = time.Minute
+)
+
+var (
+	// maxRateLimitWait caps how long bin waits for a rate limit to reset.
+	// Longer waits fail right away so the update summary can be shown.
+	maxRateLimitWait = 2 * time.Minute
+
+	sleep = time.Sleep
+)
+
+// githubTransport caches GitHub API responses on disk and revalidates
+// them with ETags, since 304 responses don't count against the rate
+// limit. It also waits and retries, up to maxRateLimitWait, when a
+// rate limit is hit.
+type githubTransport struct {
+	base     http.RoundTripper
+	token    string
+	cacheDir string
+}
+
+type cachedResponse struct {
+	ETag   string      `json:"etag"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+func (t *githubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+
+	cached := t.load(req)
+	if cached != nil {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode == http.StatusNotModified && cached != nil {
+			log.Debugf("Using cached response for %s", req.URL)
+			res.Body.Close()
+			return cached.response(req, res), nil
+		}
+
+		wait, limited := rateLimitWait(res, attempt)
+		if !limited {
+			if res.StatusCode == http.StatusOK {
+				return t.store(req, res), nil
+			}
+			return res, nil
+		}
+		if attempt >= maxRateLimitRetries || wait > maxRateLimitWait {
+			log.Debugf("Not waiting %s for the GitHub rate limit to reset", wait)
+			return res, nil
+		}
+
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		log.Warnf("GitHub rate limit reached, retrying in %s", wait.Round(time.Second))
+		sleep(wait)
+	}
+}
+
+// rateLimitWait reports if res was rejected because of a rate limit
+// and how long to wait before retrying
+func rateLimitWait(res *http.Response, attempt int) (time.Duration, bool) {
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if ra := res.Header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+
+	if res.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			wait := time.Until(time.Unix(reset, 0))
+			if wait < 0 {
+				wait = 0
+			}
+			return wait + time.Second, true
+		}
+	}
+
+	// secondary rate limits without Retry-After are only
+	// distinguishable from permission errors by the message
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return 0, false
+	}
+	msg := strings.ToLower(string(body))
+	if strings.Contains(msg, "secondary rate limit") || strings.Contains(msg, "abuse") {
+		return secondaryRateLimitWait << attempt, true
+	}
+	return 0, false
+}
+
+func (t *githubTransport) cachePath(req *http.Request) string {
+	if t.cacheDir == "" {
+		return ""
+	}
+	// the token is part of the key since private
+	// releases are only visible to some users
+	h := sha256.Sum256([]byte(t.token + "\n" + req.URL.String()))
+	return filepath.Join(t.cacheDir, fmt.Sprintf("%x.json", h))
+}
+
+func (t *githubTransport) load(req *http.Request) *cachedResponse {
+	p := t.cachePath(req)
+	if p == "" {
+		return nil
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil
+	}
+	var c cachedResponse
+	if err := json.Unmarshal(data, &c); err != nil || c.ETag == "" {
+		log.Debugf("Ignoring invalid cache entry %s: %v", p, err)
+		return nil
+	}
+	return &c
+}
+
+// store saves res in the cache if it has an ETag and returns an
+// equivalent response, since the original body is consumed
+func (t *githubTransport) store(req *http.Request, res *http.Response) *http.Response {
+	p := t.cachePath(req)
+	etag := res.Header.Get("ETag")
+	if p == "" || etag == "" {
+		return res
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return res
+	}
+
+	data, err := json.Marshal(&cachedResponse{ETag: etag, Header: res.Header, Body: body})
+	if err == nil {
+		err = os.MkdirAll(t.cacheDir, 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(p, data, 0o600)
+	}
+	if err != nil {
+		log.Debugf("Error caching response for %s: %v", req.URL, err)
+	}
+	return res
+}
+
+// response builds a 200 response from the cache, keeping the
+// rate limit headers of the 304 response
+func (c *cachedResponse) response(req *http.Request, notModified *http.Response) *http.Response {
+	header := c.Header.Clone()
+	for k, v := range notModified.Header {
+		if strings.HasPrefix(strings.ToLower(k), "x-ratelimit-") {
+			header[k] = v
+		}
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,88 @@
+package providers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGitHubTransportETag(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.Header().Set("X-RateLimit-Remaining", "59")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("X-RateLimit-Remaining", "58")
+		_, _ = w.Write([]byte(`{"tag_name": "v1.0.0"}`))
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: &githubTransport{base: http.DefaultTransport, cacheDir: t.TempDir()}}
+	for i := 0; i < 2; i++ {
+		res, err := c.Get(ts.URL + "/repos/owner/repo/releases/latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || string(body) != `{"tag_name": "v1.0.0"}` {
+			t.Fatalf("request %d: unexpected response %d %q", i, res.StatusCode, body)
+		}
+		if i == 1 && res.Header.Get("X-RateLimit-Remaining") != "59" {
+			t.Errorf("expected rate limit headers from the 304 response, got %s", res.Header.Get("X-RateLimit-Remaining"))
+		}
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestGitHubTransportRateLimit(t *testing.T) {
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { sleep = time.Sleep }()
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/secondary" && requests == 1:
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusForbidden)
+		case r.URL.Path == "/primary":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "4102444800") // 2100-01-01
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: &githubTransport{base: http.DefaultTransport}}
+
+	res, err := c.Get(ts.URL + "/secondary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || len(waits) != 1 || waits[0] != 5*time.Second {
+		t.Errorf("expected a single 5s wait and a successful retry, got %d after %v", res.StatusCode, waits)
+	}
+
+	waits = nil
+	res, err = c.Get(ts.URL + "/primary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden || len(waits) != 0 {
+		t.Errorf("expected the rate limit error without waiting past the cap, got %d after %v", res.StatusCode, waits)
+	}
+}
@@ -5,13 +5,14 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"os"
 	"sort"
 	"strings"
 
 	"github.com/caarlos0/log"
 	"github.com/coreos/go-semver/semver"
 	"github.com/marcosnils/bin/pkg/assets"
+	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/credentials"
 	"github.com/yuin/goldmark"
 	goldast "github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/text"
@@ -154,7 +155,7 @@ func (g *gitLab) Fetch(opts *FetchOpts) (*File, error) {
 		return nil, err
 	}
 
-	f := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck, NamePattern: opts.NamePattern})
+	f := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck, NamePattern: opts.NamePattern, Files: opts.Files, Extras: opts.Extras, ScoringRules: opts.ScoringRules})
 
 	gf, err := f.FilterAssets(g.repo, candidates)
 	if err != nil {
@@ -178,7 +179,7 @@ func (g *gitLab) Fetch(opts *FetchOpts) (*File, error) {
 	// TODO calculate file hash. Not sure if we can / should do it here
 	// since we don't want to read the file unnecessarily. Additionally, sometimes
 	// releases have .sha256 files, so it'd be nice to check for those also
-	file := &File{Data: outFile.Source, Name: outFile.Name, Version: version}
+	file := &File{Data: outFile.Source, Name: outFile.Name, Version: version, Asset: gf.Name, Digest: outFile.Digest, Group: groupFiles(outFile.Group, version), Extras: outFile.Extras, PickedAsset: outFile.PickedAsset, PickedFile: outFile.PickedFile}
 
 	return file, nil
 }
@@ -246,13 +247,9 @@ func newGitLab(u *url.URL) (Provider, error) {
 
 	}
 
-	token := os.Getenv("GITLAB_TOKEN")
 	hostnameSpecificEnvVarName := fmt.Sprintf("GITLAB_TOKEN_%s", strings.ReplaceAll(u.Hostname(), `.`, "_"))
-	hostnameSpecificToken := os.Getenv(hostnameSpecificEnvVarName)
-	if hostnameSpecificToken != "" {
-		token = hostnameSpecificToken
-	}
-	client, err := gitlab.NewClient(token, gitlab.WithBaseURL(fmt.Sprintf("https://%s/api/v4", u.Hostname())))
+	token := credentials.Token(u.Hostname(), hostnameSpecificEnvVarName, "GITLAB_TOKEN")
+	client, err := gitlab.NewClient(token, gitlab.WithBaseURL(config.RewriteURL(fmt.Sprintf("https://%s/api/v4", u.Hostname()))))
 	if err != nil {
 		return nil, err
 	}
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/caarlos0/log"
+	"github.com/marcosnils/bin/pkg/config"
 	"github.com/marcosnils/bin/pkg/httpclient"
 )
 
@@ -30,7 +31,7 @@ func parseRepo(path string) (string, string, string, string) {
 		name = repo[i+1:]
 	}
 
-	latestURL := fmt.Sprintf("https://proxy.golang.org/%s/@latest", repo)
+	latestURL := config.RewriteURL(fmt.Sprintf("https://proxy.golang.org/%s/@latest", repo))
 
 	return repo, tag, name, latestURL
 }
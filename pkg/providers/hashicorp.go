@@ -6,20 +6,35 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"regexp"
 	"sort"
 	"strings"
 
 	"github.com/caarlos0/log"
 	"github.com/coreos/go-semver/semver"
 	"github.com/marcosnils/bin/pkg/assets"
+	"github.com/marcosnils/bin/pkg/config"
 	"github.com/marcosnils/bin/pkg/httpclient"
-	"github.com/marcosnils/bin/pkg/options"
 )
 
 const (
-	releasesURLBase = "https://releases.hashicorp.com"
+	releasesURLBase   = "https://releases.hashicorp.com"
+	releasesAPIV1Host = "api.releases.hashicorp.com"
+
+	// hashiCorpEditionOSS is the default edition and matches
+	// versions without build metadata (e.g. 1.15.2)
+	hashiCorpEditionOSS = "oss"
+
+	// hashiCorpV1PageSize is the largest page the v1 API returns,
+	// hashiCorpV1MaxPages bounds the releases looked at for an edition
+	hashiCorpV1PageSize = 20
+	hashiCorpV1MaxPages = 50
 )
 
+// fipsSuffix matches the certification suffix HashiCorp appends to
+// FIPS builds (e.g. fips1402) so they can be selected with just "fips"
+var fipsSuffix = regexp.MustCompile(`fips[0-9]+`)
+
 type hashiCorp struct {
 	url     *url.URL
 	client  *http.Client
@@ -27,6 +42,12 @@ type hashiCorp struct {
 	repo    string
 	tag     string
 	baseURL *url.URL
+	// apiV1 is set when the binary was installed from
+	// api.releases.hashicorp.com/v1 instead of the index.json listing
+	apiV1 bool
+	// edition selects between the oss, ent, ent.hsm and fips
+	// builds that share the same version number
+	edition string
 }
 
 func (g *hashiCorp) buildHashiCorpAPIURL(args ...string) string {
@@ -39,32 +60,104 @@ func (g *hashiCorp) buildHashiCorpAPIURL(args ...string) string {
 	return apiURL.String()
 }
 
-func (g *hashiCorp) getRelease(repoName, version string) (*hashiCorpRelease, error) {
-	releaseURL := g.buildHashiCorpAPIURL(repoName, version)
-	resp, err := g.client.Get(releaseURL)
+// buildHashiCorpV1URL returns a v1 API URL for the given path segments
+// filtered by the license class of the configured edition.
+func (g *hashiCorp) buildHashiCorpV1URL(args ...string) string {
+	apiURL := &url.URL{}
+	*apiURL = *g.baseURL
+
+	apiURL.Path = path.Join(append([]string{"/v1", "releases"}, args...)...)
+	q := url.Values{}
+	q.Set("license_class", g.licenseClass())
+	apiURL.RawQuery = q.Encode()
+
+	return apiURL.String()
+}
+
+// licenseClass maps the configured edition to the v1 API license_class
+func (g *hashiCorp) licenseClass() string {
+	if g.edition == hashiCorpEditionOSS {
+		return "oss"
+	}
+	return "enterprise"
+}
+
+func (g *hashiCorp) getJSON(u string, v interface{}) error {
+	// rewrites are applied here so URLs returned to
+	// the caller always point to the original location
+	u = config.RewriteURL(u)
+	log.Debugf("Fetching %s", u)
+	resp, err := g.client.Get(u)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	decoder := json.NewDecoder(resp.Body)
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 || resp.StatusCode < 200 {
+		return fmt.Errorf("%d response when fetching %s", resp.StatusCode, u)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (g *hashiCorp) getRelease(repoName, version string) (*hashiCorpRelease, error) {
+	if g.apiV1 {
+		var release hashiCorpV1Release
+		if err := g.getJSON(g.buildHashiCorpV1URL(repoName, version), &release); err != nil {
+			return nil, err
+		}
+		return release.toRelease(), nil
+	}
+
 	var release hashiCorpRelease
-	if err := decoder.Decode(&release); err != nil {
+	if err := g.getJSON(g.buildHashiCorpAPIURL(repoName, version), &release); err != nil {
 		return nil, err
 	}
 	return &release, nil
 }
 
-func (g *hashiCorp) listReleases(repoName string) (*hashiCorpRepo, error) {
-	repoURL := g.buildHashiCorpAPIURL(repoName)
-	resp, err := g.client.Get(repoURL)
-	if err != nil {
-		return nil, err
+// listVersions returns all the published versions for repoName
+func (g *hashiCorp) listVersions(repoName string) ([]string, error) {
+	var versions []string
+	if g.apiV1 {
+		// releases come newest first, in pages of at most 20. The
+		// pages are followed until a stable version of the edition
+		// shows up since the others can fill several of them.
+		var after string
+		for page := 0; page < hashiCorpV1MaxPages; page++ {
+			u := fmt.Sprintf("%s&limit=%d", g.buildHashiCorpV1URL(repoName), hashiCorpV1PageSize)
+			if after != "" {
+				u += "&after=" + url.QueryEscape(after)
+			}
+			var releases []hashiCorpV1Release
+			if err := g.getJSON(u, &releases); err != nil {
+				return nil, err
+			}
+			for _, r := range releases {
+				if r.IsPrerelease {
+					continue
+				}
+				versions = append(versions, r.Version)
+			}
+			if len(releases) < hashiCorpV1PageSize || releases[len(releases)-1].Created == "" {
+				break
+			}
+			if _, err := latestEditionVersion(versions, g.edition); err == nil {
+				break
+			}
+			after = releases[len(releases)-1].Created
+		}
+		return versions, nil
 	}
-	decoder := json.NewDecoder(resp.Body)
+
 	var repo hashiCorpRepo
-	if err := decoder.Decode(&repo); err != nil {
+	if err := g.getJSON(g.buildHashiCorpAPIURL(repoName), &repo); err != nil {
 		return nil, err
 	}
-	return &repo, nil
+	for _, v := range repo.Versions {
+		versions = append(versions, v.Version)
+	}
+	return versions, nil
 }
 
 func (g *hashiCorp) GetID() string {
@@ -97,11 +190,21 @@ func (g *hashiCorp) Fetch(opts *FetchOpts) (*File, error) {
 	}
 
 	candidates := []*assets.Asset{}
-	for _, link := range release.Builds {
-		candidates = append(candidates, &assets.Asset{Name: link.Filename, URL: link.URL})
+	for _, build := range release.Builds {
+		if !opts.All && !build.matchesPlatform() {
+			log.Debugf("Skipping build %s for %s/%s", build.Filename, build.OS, build.Arch)
+			continue
+		}
+		candidates = append(candidates, &assets.Asset{Name: build.Filename, URL: build.URL})
+	}
+	if len(candidates) == 0 {
+		log.Debugf("No builds matched the current platform, falling back to filename scoring")
+		for _, build := range release.Builds {
+			candidates = append(candidates, &assets.Asset{Name: build.Filename, URL: build.URL})
+		}
 	}
 
-	f := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck, NamePattern: opts.NamePattern})
+	f := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck, NamePattern: opts.NamePattern, Files: opts.Files, Extras: opts.Extras, ScoringRules: opts.ScoringRules})
 	gf, err := f.FilterAssets(g.repo, candidates)
 	if err != nil {
 		return nil, err
@@ -117,7 +220,7 @@ func (g *hashiCorp) Fetch(opts *FetchOpts) (*File, error) {
 	// TODO calculate file hash. Not sure if we can / should do it here
 	// since we don't want to read the file unnecessarily. Additionally, sometimes
 	// releases have .sha256 files, so it'd be nice to check for those also
-	file := &File{Data: outFile.Source, Name: outFile.Name, Version: version}
+	file := &File{Data: outFile.Source, Name: outFile.Name, Version: version, Asset: gf.Name, Digest: outFile.Digest, Group: groupFiles(outFile.Group, version), Extras: outFile.Extras, PickedAsset: outFile.PickedAsset, PickedFile: outFile.PickedFile}
 
 	return file, nil
 }
@@ -125,75 +228,130 @@ func (g *hashiCorp) Fetch(opts *FetchOpts) (*File, error) {
 // GetLatestVersion checks the latest repo release and
 // returns the corresponding name and url to fetch the version
 func (g *hashiCorp) GetLatestVersion() (string, string, error) {
-	log.Debugf("Getting latest release for %s", g.repo)
+	log.Debugf("Getting latest %s release for %s", g.edition, g.repo)
 
-	releases, err := g.listReleases(g.repo)
+	versions, err := g.listVersions(g.repo)
 	if err != nil {
 		return "", "", err
 	}
-	if len(releases.Versions) == 0 {
+	if len(versions) == 0 {
 		return "", "", fmt.Errorf("no releases found for %s", g.repo)
 	}
+
+	highestVersion, err := latestEditionVersion(versions, g.edition)
+	if err != nil {
+		return "", "", fmt.Errorf("%w for %s", err, g.repo)
+	}
+
+	release, err := g.getRelease(g.repo, highestVersion.String())
+	if err != nil {
+		return "", "", err
+	}
+
+	return release.Version, g.releaseURL(release.Version), nil
+}
+
+// releaseURL returns the URL bin stores in the config for the given
+// version, preserving the API flavour and edition so subsequent
+// updates keep resolving the same edition.
+func (g *hashiCorp) releaseURL(version string) string {
+	var u *url.URL
+	var err error
+	if g.apiV1 {
+		u, err = url.Parse(g.buildHashiCorpV1URL(g.repo, version))
+	} else {
+		u, err = url.Parse(g.buildHashiCorpAPIURL(g.repo, version))
+	}
+	if err != nil {
+		return ""
+	}
+
+	q := u.Query()
+	q.Del("license_class")
+	if g.edition != hashiCorpEditionOSS {
+		q.Set("edition", g.edition)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// latestEditionVersion returns the highest stable version matching the
+// given edition. Versions of other editions are discarded so there's
+// never more than one candidate per version number.
+func latestEditionVersion(versions []string, edition string) (*semver.Version, error) {
 	var svs semver.Versions
-	for _, version := range releases.Versions {
-		sv, err := semver.NewVersion(version.Version)
+	for _, version := range versions {
+		sv, err := semver.NewVersion(version)
 		if err != nil {
-			log.Debugf("unable to parse %q as a semantic version: %+v", version.Version, err)
+			log.Debugf("unable to parse %q as a semantic version: %+v", version, err)
 			continue
 		}
-		if sv.PreRelease == "" && sv.Metadata == "" {
-			svs = append(svs, sv)
+		if sv.PreRelease != "" {
+			continue
+		}
+		if versionEdition(sv) != edition {
+			log.Debugf("Skipping version %s, it doesn't match edition %s", sv, edition)
+			continue
 		}
+		svs = append(svs, sv)
 	}
 	if len(svs) == 0 {
-		return "", "", fmt.Errorf("no semver versions found for %s", g.repo)
+		return nil, fmt.Errorf("no semver versions found for edition %s", edition)
 	}
 	sort.Sort(svs)
-	highestVersion := svs[len(svs)-1]
-	tied := map[string]*semver.Version{}
-	for i := len(svs) - 1; i >= 0; i-- {
-		sv := svs[i]
-		if sv.Compare(*highestVersion) == 0 {
-			tied[sv.String()] = sv
-		}
+	return svs[len(svs)-1], nil
+}
+
+// versionEdition returns the edition a version belongs to based on its
+// build metadata: 1.15.2 is oss, 1.15.2+ent is ent, 1.15.2+ent.hsm is
+// ent.hsm and 1.15.2+ent.fips1402 is ent.fips.
+func versionEdition(sv *semver.Version) string {
+	if sv.Metadata == "" {
+		return hashiCorpEditionOSS
 	}
-	if len(tied) > 1 {
-		tiedKeys := []string{}
-		for key := range tied {
-			tiedKeys = append(tiedKeys, key)
-		}
-		sort.Strings(tiedKeys)
-		generic := make([]fmt.Stringer, 0)
-		for _, key := range tiedKeys {
-			generic = append(generic, tied[key])
-		}
-		choice, err := options.Select("Select file to download:", generic)
-		if err != nil {
-			return "", "", err
+	return fipsSuffix.ReplaceAllString(sv.Metadata, "fips")
+}
+
+// matchesPlatform reports if the build targets the current OS and arch
+func (b hashiCorpBuild) matchesPlatform() bool {
+	return containsString(config.GetOS(), b.OS) && containsString(config.GetArch(), b.Arch)
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if strings.EqualFold(e, v) {
+			return true
 		}
-		highestVersion = choice.(*semver.Version)
 	}
-	release, err := g.getRelease(g.repo, highestVersion.String())
-	if err != nil {
-		return "", "", err
-	}
-
-	return release.Version, g.buildHashiCorpAPIURL(g.repo, release.Version), nil
+	return false
 }
 
 func newHashiCorp(u *url.URL) (Provider, error) {
-	s := strings.Split(u.Path, "/")
-	if len(s) < 1 {
+	baseURL, _ := url.Parse(releasesURLBase)
+
+	p := strings.Trim(u.Path, "/")
+	apiV1 := u.Hostname() == releasesAPIV1Host
+	if apiV1 {
+		baseURL = &url.URL{Scheme: "https", Host: releasesAPIV1Host}
+		p = strings.TrimPrefix(p, "v1/releases")
+		p = strings.Trim(p, "/")
+	}
+
+	s := strings.Split(p, "/")
+	if len(s) < 1 || s[0] == "" {
 		return nil, fmt.Errorf("Error parsing HashiCorp releases URL %s, can't find repo", u.String())
 	}
 
 	// it's a specific releases URL
 	var tag string
-	if len(s) >= 3 {
-		tag = s[2]
+	if len(s) >= 2 && s[1] != "index.json" {
+		tag = s[1]
 	}
 
-	baseURL, _ := url.Parse(releasesURLBase)
+	edition := strings.ToLower(u.Query().Get("edition"))
+	if edition == "" {
+		edition = hashiCorpEditionOSS
+	}
 
-	return &hashiCorp{url: u, client: httpclient.Client, owner: "", repo: s[1], tag: tag, baseURL: baseURL}, nil
+	return &hashiCorp{url: u, client: httpclient.Client, owner: "", repo: s[0], tag: tag, baseURL: baseURL, apiV1: apiV1, edition: edition}, nil
 }
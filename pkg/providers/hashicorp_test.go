@@ -0,0 +1,133 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestLatestEditionVersion(t *testing.T) {
+	versions := []string{
+		"1.15.1",
+		"1.15.2",
+		"1.15.2+ent",
+		"1.15.2+ent.hsm",
+		"1.15.2+ent.fips1402",
+		"1.15.3-rc1",
+		"1.15.3-rc1+ent",
+		"1.14.9+ent",
+	}
+
+	cases := []struct {
+		edition string
+		want    string
+		wantErr bool
+	}{
+		{edition: "oss", want: "1.15.2"},
+		{edition: "ent", want: "1.15.2+ent"},
+		{edition: "ent.hsm", want: "1.15.2+ent.hsm"},
+		{edition: "ent.fips", want: "1.15.2+ent.fips1402"},
+		{edition: "fips", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.edition, func(t *testing.T) {
+			v, err := latestEditionVersion(versions, c.edition)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.String() != c.want {
+				t.Errorf("expected %s, got %s", c.want, v)
+			}
+		})
+	}
+}
+
+func TestNewHashiCorp(t *testing.T) {
+	cases := []struct {
+		in                 string
+		repo, tag, edition string
+		apiV1              bool
+	}{
+		{in: "https://releases.hashicorp.com/terraform", repo: "terraform", edition: "oss"},
+		{in: "https://releases.hashicorp.com/terraform/1.12.1", repo: "terraform", tag: "1.12.1", edition: "oss"},
+		{in: "https://releases.hashicorp.com/vault/1.15.2+ent/index.json?edition=ent", repo: "vault", tag: "1.15.2+ent", edition: "ent"},
+		{in: "https://api.releases.hashicorp.com/v1/releases/consul?edition=ent.hsm", repo: "consul", edition: "ent.hsm", apiV1: true},
+		{in: "https://api.releases.hashicorp.com/v1/releases/consul/1.17.0", repo: "consul", tag: "1.17.0", edition: "oss", apiV1: true},
+	}
+
+	for _, c := range cases {
+		u, err := url.Parse(c.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := newHashiCorp(u)
+		if err != nil {
+			t.Fatalf("%s: %v", c.in, err)
+		}
+		h := p.(*hashiCorp)
+		if h.repo != c.repo || h.tag != c.tag || h.edition != c.edition || h.apiV1 != c.apiV1 {
+			t.Errorf("%s: got repo=%q tag=%q edition=%q apiV1=%v", c.in, h.repo, h.tag, h.edition, h.apiV1)
+		}
+	}
+}
+
+func TestHashiCorpV1Pages(t *testing.T) {
+	// 45 releases newest first, the only ent.hsm one on the third page
+	var releases []hashiCorpV1Release
+	for i := 45; i > 0; i-- {
+		v := fmt.Sprintf("1.%d.0+ent", i)
+		if i == 3 {
+			v = "1.3.0+ent.hsm"
+		}
+		releases = append(releases, hashiCorpV1Release{Version: v, Created: strconv.Itoa(i)})
+	}
+
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		start := 0
+		if after := r.URL.Query().Get("after"); after != "" {
+			for start < len(releases) && releases[start].Created != after {
+				start++
+			}
+			start++
+		}
+		_ = json.NewEncoder(w).Encode(releases[start:min(start+limit, len(releases))])
+	}))
+	defer ts.Close()
+
+	baseURL, _ := url.Parse(ts.URL)
+	for _, c := range []struct {
+		edition, want string
+		requests      int
+	}{
+		{"ent", "1.45.0+ent", 1},
+		{"ent.hsm", "1.3.0+ent.hsm", 3},
+	} {
+		requests = nil
+		h := &hashiCorp{client: ts.Client(), repo: "vault", baseURL: baseURL, apiV1: true, edition: c.edition}
+		versions, err := h.listVersions("vault")
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := latestEditionVersion(versions, c.edition)
+		if err != nil {
+			t.Fatalf("%s: %v", c.edition, err)
+		}
+		if v.String() != c.want || len(requests) != c.requests {
+			t.Errorf("%s: got %s after the requests %q", c.edition, v, requests)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package providers
 
+import "path"
+
 type hashiCorpRelease struct {
 	Name             string           `json:"name"`
 	Version          string           `json:"version"`
@@ -29,3 +31,42 @@ type hashiCorpBuild struct {
 	Filename string `json:"filename"`
 	URL      string `json:"url"`
 }
+
+// hashiCorpV1Release is a release as returned by
+// https://api.releases.hashicorp.com/v1/releases/<product>
+type hashiCorpV1Release struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	LicenseClass string `json:"license_class"`
+	IsPrerelease bool   `json:"is_prerelease"`
+	// Created is the cursor of the next page of releases
+	Created string             `json:"timestamp_created"`
+	Builds  []hashiCorpV1Build `json:"builds"`
+}
+
+type hashiCorpV1Build struct {
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	URL         string `json:"url"`
+	Unsupported bool   `json:"unsupported"`
+}
+
+// toRelease converts a v1 API release to the index.json
+// representation used by the rest of the provider
+func (r *hashiCorpV1Release) toRelease() *hashiCorpRelease {
+	release := &hashiCorpRelease{Name: r.Name, Version: r.Version}
+	for _, b := range r.Builds {
+		if b.Unsupported {
+			continue
+		}
+		release.Builds = append(release.Builds, hashiCorpBuild{
+			Name:     r.Name,
+			Version:  r.Version,
+			OS:       b.OS,
+			Arch:     b.Arch,
+			Filename: path.Base(b.URL),
+			URL:      b.URL,
+		})
+	}
+	return release
+}
@@ -0,0 +1,379 @@
+package providers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/caarlos0/log"
+	"github.com/coreos/go-semver/semver"
+	"github.com/marcosnils/bin/pkg/assets"
+	"github.com/marcosnils/bin/pkg/config"
+)
+
+// pluginProtocolVersion is sent on every request so plugins
+// can detect incompatible bin versions
+const pluginProtocolVersion = 1
+
+const pluginPrefix = "bin-provider-"
+
+const (
+	pluginCommandFetch         = "fetch"
+	pluginCommandLatestVersion = "latest-version"
+	pluginCommandListVersions  = "list-versions"
+)
+
+var (
+	schemePrefix = regexp.MustCompile("^([a-z0-9][a-z0-9+.-]*)://")
+
+	errPluginUnsupported = errors.New("command not supported by plugin")
+
+	// builtinProviders can't be overridden by plugins
+	builtinProviders = map[string]bool{
+		"github":    true,
+		"gitlab":    true,
+		"codeberg":  true,
+		"hashicorp": true,
+		"docker":    true,
+		"goinstall": true,
+		"file":      true,
+		"s3":        true,
+	}
+)
+
+// plugin is a provider implemented by an external executable named
+// bin-provider-<id>. bin writes a single JSON request to the plugin
+// stdin and reads a JSON response from its stdout. For `fetch`, the
+// plugin can either return a list of assets to select from or set
+// `stream` and write the file contents right after the JSON response.
+type plugin struct {
+	id   string
+	path string
+	url  string
+}
+
+type pluginRequest struct {
+	Protocol int      `json:"protocol"`
+	Command  string   `json:"command"`
+	URL      string   `json:"url"`
+	Version  string   `json:"version,omitempty"`
+	OS       []string `json:"os"`
+	Arch     []string `json:"arch"`
+}
+
+type pluginAsset struct {
+	Name        string            `json:"name"`
+	DisplayName string            `json:"display_name,omitempty"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	// Digest is the hex encoded sha256 of the asset, if known
+	Digest string `json:"digest,omitempty"`
+}
+
+type pluginResponse struct {
+	Error string `json:"error,omitempty"`
+	// Unsupported is set by plugins that don't implement the command
+	Unsupported bool          `json:"unsupported,omitempty"`
+	Version     string        `json:"version,omitempty"`
+	URL         string        `json:"url,omitempty"`
+	Versions    []string      `json:"versions,omitempty"`
+	Assets      []pluginAsset `json:"assets,omitempty"`
+	// Name and Stream are used when the plugin streams the
+	// file contents after the response
+	Name   string `json:"name,omitempty"`
+	Stream bool   `json:"stream,omitempty"`
+}
+
+func (p *plugin) GetID() string {
+	return p.id
+}
+
+func (p *plugin) Fetch(opts *FetchOpts) (*File, error) {
+	log.Infof("Fetching %s using plugin %s", p.url, p.path)
+	res, stream, err := p.call(&pluginRequest{Command: pluginCommandFetch, Version: opts.Version})
+	if err != nil {
+		return nil, err
+	}
+	if stream != nil {
+		defer stream.Close()
+	}
+
+	f := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck, PackageName: opts.PackageName, NamePattern: opts.NamePattern, Files: opts.Files, Extras: opts.Extras, ScoringRules: opts.ScoringRules})
+
+	var data io.Reader
+	var name, packagePath, asset, digest string
+	var group []*assets.GroupMember
+	var extras []*assets.ExtraFile
+	var pickedAsset, pickedFile bool
+	if res.Stream {
+		if res.Name == "" {
+			return nil, fmt.Errorf("plugin %s streamed a file without a name", p.id)
+		}
+		outFile, err := f.ProcessReader(res.Name, stream)
+		if err != nil {
+			return nil, err
+		}
+		data, name, packagePath, group, extras = outFile.Source, outFile.Name, outFile.PackagePath, outFile.Group, outFile.Extras
+		pickedFile = outFile.PickedFile
+	} else {
+		if len(res.Assets) == 0 {
+			return nil, fmt.Errorf("plugin %s didn't return any assets for %s", p.id, p.url)
+		}
+		candidates := []*assets.Asset{}
+		headers := map[string]map[string]string{}
+		for _, a := range res.Assets {
+			candidates = append(candidates, &assets.Asset{Name: a.Name, DisplayName: a.DisplayName, URL: a.URL, Digest: a.Digest})
+			headers[a.URL] = a.Headers
+		}
+
+		gf, err := f.FilterAssets(filepath.Base(p.url), candidates)
+		if err != nil {
+			return nil, err
+		}
+		gf.ExtraHeaders = headers[gf.URL]
+
+		outFile, err := f.ProcessURL(gf)
+		if err != nil {
+			return nil, err
+		}
+		data, name, packagePath, asset, digest, group, extras = outFile.Source, outFile.Name, outFile.PackagePath, gf.Name, outFile.Digest, outFile.Group, outFile.Extras
+		pickedAsset, pickedFile = outFile.PickedAsset, outFile.PickedFile
+	}
+
+	version := res.Version
+	if version == "" {
+		version = opts.Version
+	}
+
+	return &File{Data: data, Name: name, Version: version, PackagePath: packagePath, Asset: asset, Digest: digest, Group: groupFiles(group, version), Extras: extras, PickedAsset: pickedAsset, PickedFile: pickedFile}, nil
+}
+
+// GetLatestVersion asks the plugin for the latest version. If the plugin
+// doesn't implement `latest-version`, the highest version returned by
+// `list-versions` is used instead.
+func (p *plugin) GetLatestVersion() (string, string, error) {
+	log.Debugf("Getting latest version for %s using plugin %s", p.url, p.path)
+	res, stream, err := p.call(&pluginRequest{Command: pluginCommandLatestVersion})
+	if stream != nil {
+		stream.Close()
+	}
+	if err == nil {
+		u := res.URL
+		if u == "" {
+			u = p.url
+		}
+		return res.Version, u, nil
+	}
+	if !errors.Is(err, errPluginUnsupported) {
+		return "", "", err
+	}
+
+	versions, err := p.ListVersions()
+	if err != nil {
+		return "", "", err
+	}
+	if len(versions) == 0 {
+		return "", "", fmt.Errorf("plugin %s didn't return any versions for %s", p.id, p.url)
+	}
+	return highestVersion(versions), p.url, nil
+}
+
+// ListVersions returns all the versions the plugin knows about
+func (p *plugin) ListVersions() ([]string, error) {
+	res, stream, err := p.call(&pluginRequest{Command: pluginCommandListVersions})
+	if err != nil {
+		return nil, err
+	}
+	if stream != nil {
+		stream.Close()
+	}
+	return res.Versions, nil
+}
+
+// call runs the plugin with the given request. The returned reader holds
+// whatever the plugin wrote after the JSON response and must be closed
+// so the plugin process is reaped.
+func (p *plugin) call(req *pluginRequest) (*pluginResponse, io.ReadCloser, error) {
+	req.Protocol = pluginProtocolVersion
+	req.URL = p.url
+	req.OS = config.GetOS()
+	req.Arch = config.GetArch()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmd := exec.Command(p.path, req.Command)
+	cmd.Stdin = strings.NewReader(string(body) + "\n")
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Debugf("Running plugin %s %s", p.path, req.Command)
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("error running plugin %s: %w", p.path, err)
+	}
+
+	br := bufio.NewReader(stdout)
+	dec := json.NewDecoder(br)
+	var res pluginResponse
+	if err := dec.Decode(&res); err != nil {
+		_ = cmd.Wait()
+		return nil, nil, fmt.Errorf("invalid response from plugin %s: %w", p.path, err)
+	}
+
+	if !res.Stream {
+		if err := cmd.Wait(); err != nil && res.Error == "" && !res.Unsupported {
+			return nil, nil, fmt.Errorf("plugin %s failed: %w", p.path, err)
+		}
+	}
+
+	if res.Stream && (res.Unsupported || res.Error != "") {
+		// nothing is going to read the stream
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+	switch {
+	case res.Unsupported:
+		return nil, nil, fmt.Errorf("%s %s: %w", p.id, req.Command, errPluginUnsupported)
+	case res.Error != "":
+		return nil, nil, fmt.Errorf("plugin %s: %s", p.id, res.Error)
+	}
+
+	if !res.Stream {
+		return &res, nil, nil
+	}
+
+	// the decoder might have buffered part of the stream, so
+	// read from there before continuing with stdout.
+	rest := io.MultiReader(dec.Buffered(), br)
+	// skip the newline that usually terminates the JSON response
+	rest = skipLeadingNewline(rest)
+	return &res, &waitReader{r: rest, cmd: cmd}, nil
+}
+
+// skipLeadingNewline drops a single "\n" (or "\r\n") at the start of r
+func skipLeadingNewline(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(2); err == nil && b[0] == '\r' && b[1] == '\n' {
+		_, _ = br.Discard(2)
+	} else if b, err := br.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = br.Discard(1)
+	}
+	return br
+}
+
+// waitReader waits for the plugin process once its output is consumed
+// so a non-zero exit status is surfaced as a read error. Closing it
+// before that kills the plugin.
+type waitReader struct {
+	r    io.Reader
+	cmd  *exec.Cmd
+	once sync.Once
+	err  error
+	eof  bool
+}
+
+func (w *waitReader) Read(p []byte) (int, error) {
+	n, err := w.r.Read(p)
+	if err == io.EOF {
+		w.eof = true
+		if werr := w.wait(); werr != nil {
+			return n, fmt.Errorf("plugin %s failed: %w", w.cmd.Path, werr)
+		}
+	}
+	return n, err
+}
+
+// Close kills the plugin if its output wasn't read until
+// the end and waits for it, so it doesn't become a zombie
+func (w *waitReader) Close() error {
+	if !w.eof {
+		_ = w.cmd.Process.Kill()
+	}
+	_ = w.wait()
+	return nil
+}
+
+func (w *waitReader) wait() error {
+	w.once.Do(func() { w.err = w.cmd.Wait() })
+	return w.err
+}
+
+// highestVersion returns the highest semver version of vs, falling back
+// to the first one when none of them can be parsed
+func highestVersion(vs []string) string {
+	var svs semver.Versions
+	original := map[*semver.Version]string{}
+	for _, v := range vs {
+		sv, err := semver.NewVersion(strings.TrimPrefix(v, "v"))
+		if err != nil {
+			log.Debugf("unable to parse %q as a semantic version: %+v", v, err)
+			continue
+		}
+		svs = append(svs, sv)
+		original[sv] = v
+	}
+	if len(svs) == 0 {
+		return vs[0]
+	}
+	sort.Sort(svs)
+	return original[svs[len(svs)-1]]
+}
+
+// findPlugin looks up the bin-provider-<id> executable, first in the
+// plugins directory and then in PATH.
+func findPlugin(id string) (string, error) {
+	name := pluginPrefix + id
+	if dir, err := config.GetPluginsDir(); err == nil {
+		candidates := []string{filepath.Join(dir, name)}
+		if runtime.GOOS == "windows" {
+			candidates = append(candidates, filepath.Join(dir, name+".exe"))
+		}
+		for _, c := range candidates {
+			if fi, err := os.Stat(c); err == nil && !fi.IsDir() {
+				return c, nil
+			}
+		}
+	}
+	return exec.LookPath(name)
+}
+
+// newPlugin returns a plugin provider for u if the provider id (either
+// explicitly set or taken from the URL scheme) has a matching executable.
+// It returns a nil provider when no plugin applies.
+func newPlugin(u, provider string) (Provider, error) {
+	id := provider
+	if builtinProviders[id] {
+		return nil, nil
+	}
+	if id == "" {
+		m := schemePrefix.FindStringSubmatch(u)
+		if m == nil || m[1] == "http" || m[1] == "https" {
+			return nil, nil
+		}
+		id = m[1]
+	}
+
+	path, err := findPlugin(id)
+	if err != nil {
+		log.Debugf("No plugin found for provider %s: %v", id, err)
+		return nil, nil
+	}
+
+	log.Debugf("Using plugin %s for provider %s", path, id)
+	return &plugin{id: id, path: path, url: u}, nil
+}
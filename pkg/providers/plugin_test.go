@@ -0,0 +1,114 @@
+package providers
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const testPlugin = `#!/bin/sh
+read -r req
+case "$1" in
+  latest-version)
+    echo '{"unsupported": true}'
+    ;;
+  list-versions)
+    echo '{"versions": ["v1.2.0", "v1.10.0", "v1.9.3"]}'
+    ;;
+  fetch)
+    echo '{"version": "v1.10.0", "name": "mytool", "stream": true}'
+    printf 'binary contents'
+    ;;
+  hang)
+    echo '{"version": "v1.10.0", "name": "mytool", "stream": true}'
+    printf 'partial'
+    exec sleep 30
+    ;;
+  stream-error)
+    echo $$ > "$PLUGIN_PID"
+    echo '{"error": "broken", "stream": true}'
+    exec sleep 30
+    ;;
+  *)
+    echo '{"error": "unknown command"}'
+    exit 1
+    ;;
+esac
+`
+
+func TestPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test plugin is a shell script")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bin-provider-internal"), []byte(testPlugin), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BIN_PLUGINS_DIR", dir)
+
+	p, err := New("internal://team/mytool", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.GetID() != "internal" {
+		t.Fatalf("expected plugin provider, got %s", p.GetID())
+	}
+
+	v, u, err := p.GetLatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "v1.10.0" || u != "internal://team/mytool" {
+		t.Errorf("unexpected latest version %s (%s)", v, u)
+	}
+
+	f, err := p.Fetch(&FetchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "mytool" || f.Version != "v1.10.0" || string(data) != "binary contents" {
+		t.Errorf("unexpected file %s@%s: %q", f.Name, f.Version, data)
+	}
+
+	// a stream closed before the end kills the plugin
+	_, stream, err := p.(*plugin).call(&pluginRequest{Command: "hang"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	stream.Close()
+	if stream.(*waitReader).cmd.ProcessState == nil || time.Since(start) > 10*time.Second {
+		t.Error("the plugin wasn't stopped")
+	}
+
+	// and so does an error with a stream
+	pidFile := filepath.Join(dir, "pid")
+	t.Setenv("PLUGIN_PID", pidFile)
+	if _, _, err := p.(*plugin).call(&pluginRequest{Command: "stream-error"}); err == nil {
+		t.Error("expected an error")
+	}
+	pid, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(pid)))
+	if proc, err := os.FindProcess(n); err == nil && proc.Signal(syscall.Signal(0)) == nil {
+		_ = proc.Kill()
+		t.Error("the plugin wasn't stopped after an error")
+	}
+
+	if _, err := New("unknown://team/mytool", ""); err == nil {
+		t.Errorf("expected error for URL without plugin")
+	}
+}
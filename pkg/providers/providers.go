@@ -6,18 +6,58 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
+
+	"github.com/marcosnils/bin/pkg/assets"
+	"github.com/marcosnils/bin/pkg/config"
 )
 
 var ErrInvalidProvider = errors.New("invalid provider")
 
+// RateLimitError is returned when a provider API rate
+// limit is exhausted for a host
+type RateLimitError struct {
+	Host      string
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	Err       error
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("API rate limit exceeded for %s (limit %d), resets at %s", e.Host, e.Limit, e.Reset.Local().Format(time.Kitchen))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
 type File struct {
 	Data        io.Reader
 	Name        string
 	Version     string
 	Length      int64
 	PackagePath string
+	// Asset is the name of the release asset
+	// the file was selected from, if any
+	Asset string
+	// Digest is the sha256 of the asset when it
+	// was downloaded, see assets.finalFile
+	Digest string
+	// PickedAsset and PickedFile are set when the asset or
+	// the archive file were picked from a prompt
+	PickedAsset bool
+	PickedFile  bool
+	// Group holds every file selected with FetchOpts.Files,
+	// the fields above describe its first member
+	Group []*File
+	// Extras are the completions and man pages found
+	// when FetchOpts.Extras is set
+	Extras []*assets.ExtraFile
 }
 
 func (f *File) Hash() ([]byte, error) {
@@ -34,7 +74,14 @@ type FetchOpts struct {
 	PackagePath    string
 	SkipPatchCheck bool
 	Version        string
-	NamePattern string
+	NamePattern    string
+	// Files selects several files from an archive to
+	// be installed together, see assets.FilterOpts
+	Files []string
+	// Extras looks for completions and man pages in archives
+	Extras bool
+	// ScoringRules of the binary being fetched
+	ScoringRules []*config.ScoringRule
 }
 
 type Provider interface {
@@ -53,15 +100,43 @@ var (
 	httpUrlPrefix      = regexp.MustCompile("^https?://")
 	dockerUrlPrefix    = regexp.MustCompile("^docker://")
 	goinstallUrlPrefix = regexp.MustCompile("^goinstall://")
+	fileUrlPrefix      = regexp.MustCompile("^file://")
+	s3UrlPrefix        = regexp.MustCompile("^s3://")
 )
 
+// LocalPath returns the absolute path of u if it's a relative path
+// to an existing file or directory, like ./dist/tool.tar.gz, or u
+// itself otherwise
+func LocalPath(u string) string {
+	if strings.Contains(u, "://") || filepath.IsAbs(u) {
+		return u
+	}
+	if _, err := os.Stat(u); err != nil {
+		return u
+	}
+	if abs, err := filepath.Abs(u); err == nil {
+		return abs
+	}
+	return u
+}
+
 func New(u, provider string) (Provider, error) {
+	u = LocalPath(u)
 	if dockerUrlPrefix.MatchString(u) {
 		return newDocker(u)
 	}
 	if goinstallUrlPrefix.MatchString(u) || provider == "goinstall" {
 		return newGoInstall(u)
 	}
+	if fileUrlPrefix.MatchString(u) || provider == "file" || filepath.IsAbs(u) {
+		return newFile(u)
+	}
+	if s3UrlPrefix.MatchString(u) || provider == "s3" {
+		return newS3(u)
+	}
+	if p, err := newPlugin(u, provider); p != nil || err != nil {
+		return p, err
+	}
 	if !httpUrlPrefix.MatchString(u) {
 		u = fmt.Sprintf("https://%s", u)
 	}
@@ -71,7 +146,9 @@ func New(u, provider string) (Provider, error) {
 		return nil, err
 	}
 
-	if strings.Contains(purl.Host, "github") || provider == "github" {
+	// hosts that merely contain "github" are still GHES instances
+	// with the default API URLs, as they always were
+	if purl.Hostname() == "github.com" || purl.Hostname() == "www.github.com" || provider == "github" || isGitHubEnterpriseHost(purl.Hostname()) || strings.Contains(purl.Host, "github") {
 		return newGitHub(purl)
 	}
 
@@ -89,3 +166,13 @@ func New(u, provider string) (Provider, error) {
 
 	return nil, fmt.Errorf("Can't find provider for url %s", u)
 }
+
+// groupFiles converts the members of a group selected
+// from an archive into files of the given version
+func groupFiles(members []*assets.GroupMember, version string) []*File {
+	var files []*File
+	for _, m := range members {
+		files = append(files, &File{Data: m.Source, Name: m.Name, Version: version, PackagePath: m.PackagePath})
+	}
+	return files
+}
@@ -0,0 +1,270 @@
+package providers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/log"
+	"github.com/hashicorp/go-version"
+	"github.com/marcosnils/bin/pkg/assets"
+	"github.com/marcosnils/bin/pkg/config"
+	"github.com/marcosnils/bin/pkg/httpclient"
+)
+
+// s3 installs binaries from S3 compatible buckets using
+// a <prefix>/<version>/<file> layout
+type s3 struct {
+	url      string
+	client   *http.Client
+	bucket   string
+	prefix   string
+	endpoint *url.URL
+	// pathStyle is used for custom endpoints (e.g. MinIO) which
+	// usually don't support virtual hosted buckets
+	pathStyle bool
+	region    string
+	creds     *awsCredentials
+}
+
+type s3ListResult struct {
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *s3) GetID() string {
+	return "s3"
+}
+
+func (s *s3) Fetch(opts *FetchOpts) (*File, error) {
+	v := opts.Version
+	if v == "" {
+		var err error
+		if v, _, err = s.GetLatestVersion(); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Infof("Getting %s release for s3://%s/%s", v, s.bucket, s.prefix)
+	_, keys, err := s.list(s.versionPrefix(v))
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no files found in s3://%s/%s", s.bucket, s.versionPrefix(v))
+	}
+
+	candidates := []*assets.Asset{}
+	for _, k := range keys {
+		candidates = append(candidates, &assets.Asset{Name: path.Base(k), URL: s.objectURL(k).String()})
+	}
+
+	f := assets.NewFilter(&assets.FilterOpts{SkipScoring: opts.All, PackagePath: opts.PackagePath, SkipPathCheck: opts.SkipPatchCheck, PackageName: opts.PackageName, NamePattern: opts.NamePattern, Files: opts.Files, Extras: opts.Extras, ScoringRules: opts.ScoringRules})
+	gf, err := f.FilterAssets(path.Base(s.prefix), candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.creds != nil {
+		// the download goes to the rewritten URL, so that's
+		// the host and path the signature has to be for
+		req, err := http.NewRequest(http.MethodGet, config.RewriteURL(gf.URL), nil)
+		if err != nil {
+			return nil, err
+		}
+		signV4(req, s.creds, s.region, time.Now())
+		gf.ExtraHeaders = map[string]string{}
+		for k := range req.Header {
+			gf.ExtraHeaders[k] = req.Header.Get(k)
+		}
+	}
+
+	outFile, err := f.ProcessURL(gf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{Data: outFile.Source, Name: outFile.Name, Version: v, PackagePath: outFile.PackagePath, Asset: gf.Name, Digest: outFile.Digest, Group: groupFiles(outFile.Group, v), Extras: outFile.Extras, PickedAsset: outFile.PickedAsset, PickedFile: outFile.PickedFile}, nil
+}
+
+// GetLatestVersion lists the version prefixes under the configured
+// prefix and returns the highest one
+func (s *s3) GetLatestVersion() (string, string, error) {
+	log.Debugf("Getting latest release for s3://%s/%s", s.bucket, s.prefix)
+	prefixes, _, err := s.list(s.versionPrefix(""))
+	if err != nil {
+		return "", "", err
+	}
+
+	var vs version.Collection
+	original := map[*version.Version]string{}
+	for _, p := range prefixes {
+		name := path.Base(strings.TrimSuffix(p, "/"))
+		sv, err := version.NewVersion(name)
+		if err != nil {
+			log.Debugf("Skipping prefix %s, it's not a version: %v", p, err)
+			continue
+		}
+		if sv.Prerelease() != "" {
+			continue
+		}
+		vs = append(vs, sv)
+		original[sv] = name
+	}
+	if len(vs) == 0 {
+		return "", "", fmt.Errorf("no versions found in s3://%s/%s", s.bucket, s.prefix)
+	}
+	sort.Sort(vs)
+
+	return original[vs[len(vs)-1]], s.url, nil
+}
+
+// versionPrefix returns the key prefix for the given version,
+// or the prefix containing all the versions if it's empty
+func (s *s3) versionPrefix(v string) string {
+	p := s.prefix
+	if v != "" {
+		p = path.Join(p, v)
+	}
+	if p == "" {
+		return ""
+	}
+	return p + "/"
+}
+
+// list returns the common prefixes and object keys directly
+// under prefix, following continuation tokens
+func (s *s3) list(prefix string) ([]string, []string, error) {
+	var prefixes, keys []string
+	token := ""
+	for {
+		u := s.bucketURL()
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("delimiter", "/")
+		q.Set("prefix", prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = q.Encode()
+
+		var res s3ListResult
+		if err := s.get(u, &res); err != nil {
+			return nil, nil, err
+		}
+		for _, p := range res.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		for _, c := range res.Contents {
+			if strings.HasSuffix(c.Key, "/") {
+				continue
+			}
+			keys = append(keys, c.Key)
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+	return prefixes, keys, nil
+}
+
+func (s *s3) get(u *url.URL, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, config.RewriteURL(u.String()), nil)
+	if err != nil {
+		return err
+	}
+	if s.creds != nil {
+		signV4(req, s.creds, s.region, time.Now())
+	}
+
+	log.Debugf("Listing %s", req.URL)
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode > 299 || res.StatusCode < 200 {
+		return fmt.Errorf("%d response when listing s3://%s/%s", res.StatusCode, s.bucket, s.prefix)
+	}
+
+	return xml.NewDecoder(res.Body).Decode(v)
+}
+
+func (s *s3) bucketURL() *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/"
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/"
+	}
+	return &u
+}
+
+func (s *s3) objectURL(key string) *url.URL {
+	u := s.bucketURL()
+	u.Path = path.Join(u.Path, key)
+	return u
+}
+
+// newS3 parses s3://bucket/prefix URLs. Custom endpoints (MinIO, etc.)
+// can be set with the endpoint query parameter or the standard
+// AWS_ENDPOINT_URL_S3 and AWS_ENDPOINT_URL variables. The region can
+// also be set with the region query parameter.
+func newS3(u string) (Provider, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	if pu.Host == "" {
+		return nil, fmt.Errorf("error parsing S3 URL %s, can't find bucket", u)
+	}
+
+	region := pu.Query().Get("region")
+	if region == "" {
+		region = loadAWSRegion()
+	}
+
+	endpoint := pu.Query().Get("endpoint")
+	for _, e := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint != "" {
+			break
+		}
+		endpoint = os.Getenv(e)
+	}
+
+	pathStyle := endpoint != ""
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	eu, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %s: %w", endpoint, err)
+	}
+
+	return &s3{
+		url:       u,
+		client:    httpclient.Client,
+		bucket:    pu.Host,
+		prefix:    strings.Trim(pu.Path, "/"),
+		endpoint:  eu,
+		pathStyle: pathStyle,
+		region:    region,
+		creds:     loadAWSCredentials(),
+	}, nil
+}
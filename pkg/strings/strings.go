@@ -1,6 +1,9 @@
 package strings
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 func ContainsAny(s string, v []string) bool {
 	for _, val := range v {
@@ -10,3 +13,17 @@ func ContainsAny(s string, v []string) bool {
 	}
 	return false
 }
+
+// HumanSize formats a size in bytes like 1.5 MiB
+func HumanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}